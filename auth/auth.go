@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+type Role string
+
+const (
+	ROLE_READER   Role = "reader"
+	ROLE_INGESTER Role = "ingester"
+	ROLE_ADMIN    Role = "admin"
+
+	HASH_PREFIX string = "sha256:"
+)
+
+// API token loaded from tokens file, raw token value is never stored
+type Token struct {
+	Name       string
+	Hash       string
+	Role       Role
+	Hosts      []string
+	Facilities []string
+	// Tenant which messages are available to the token, tokens without tenant use the default one
+	Tenant string
+}
+
+// List of known tokens
+type Tokens struct {
+	tokens []*Token
+}
+
+// Loads tokens from file. Each section of the file describes one token:
+//
+//	[deploy-bot]
+//	hash = sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+//	role = ingester
+//	hosts = api*, web*
+//	facilities = nginx
+func LoadTokens(filename string) (*Tokens, error) {
+	c, err := gc.ReadDefault(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Tokens{tokens: []*Token{}}
+
+	for _, name := range c.Sections() {
+		if name == gc.DEFAULT_SECTION {
+			continue
+		}
+
+		hash, err := c.String(name, "hash")
+		if err != nil || !strings.HasPrefix(hash, HASH_PREFIX) {
+			return nil, fmt.Errorf("Token «%s» must have hash in format %s<hex>", name, HASH_PREFIX)
+		}
+
+		roleName, err := c.String(name, "role")
+		if err != nil {
+			return nil, fmt.Errorf("Role of token «%s» is not provided", name)
+		}
+
+		role := Role(strings.TrimSpace(roleName))
+		if role != ROLE_READER && role != ROLE_INGESTER && role != ROLE_ADMIN {
+			return nil, fmt.Errorf("Token «%s» has unknown role «%s»", name, roleName)
+		}
+
+		hosts, _ := c.String(name, "hosts")
+		facilities, _ := c.String(name, "facilities")
+		tenant, _ := c.String(name, "tenant")
+
+		tenant = strings.TrimSpace(tenant)
+		if err := storage.ValidateTenantName(tenant); err != nil {
+			return nil, err
+		}
+
+		result.tokens = append(result.tokens, &Token{
+			Name:       name,
+			Hash:       strings.ToLower(strings.TrimSpace(hash)),
+			Role:       role,
+			Hosts:      config.SplitList(hosts),
+			Facilities: config.SplitList(facilities),
+			Tenant:     tenant,
+		})
+	}
+
+	if len(result.tokens) == 0 {
+		return nil, errors.New("Tokens file doesn't contain any token")
+	}
+
+	return result, nil
+}
+
+// Returns token by its raw value
+func (t *Tokens) Find(raw string) *Token {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	hash := HashToken(raw)
+
+	for _, token := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) == 1 {
+			return token
+		}
+	}
+
+	return nil
+}
+
+// Checks if token grants the role. Admin is allowed to do everything
+func (t *Token) Allows(role Role) bool {
+	return t.Role == ROLE_ADMIN || t.Role == role
+}
+
+// Checks if token has access to messages with provided host and facility
+func (t *Token) AllowsMessage(host, facility string) bool {
+	return matchAny(t.Hosts, host) && matchAny(t.Facilities, facility)
+}
+
+// Injects token restrictions into search query, only admins without tenant may choose tenant of the query
+func (t *Token) Restrict(q *storage.SearchQuery) {
+	q.Hosts = t.Hosts
+	q.Facilities = t.Facilities
+
+	if len(t.Tenant) > 0 || t.Role != ROLE_ADMIN {
+		q.Tenant = t.Tenant
+	}
+}
+
+// Returns hash of the raw token in format that is stored in tokens file
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+
+	return HASH_PREFIX + hex.EncodeToString(sum[:])
+}
+
+// Generates new random token
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Checks if value matches any of shell-like patterns, empty list of patterns matches everything
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
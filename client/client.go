@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/endeveit/recause/storage"
+)
+
+// Client of the recause HTTP API
+type Client struct {
+	server string
+	token  string
+	http   *http.Client
+	// Streams are long-living, so they are read without timeout
+	stream *http.Client
+}
+
+// Error returned by the API
+type ApiError struct {
+	Code    int
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("API responded with %d: %s", e.Code, e.Message)
+}
+
+// Maximum size of a single event of the stream
+const maxEventSize int = 4 * 1024 * 1024
+
+type response struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Returns client of the server available at URL like http://127.0.0.1:8094, token may be empty
+func NewClient(server, token string) *Client {
+	return &Client{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: time.Minute},
+		stream: &http.Client{},
+	}
+}
+
+// Searches messages
+func (c *Client) Search(q *storage.SearchQuery) (*storage.SearchResult, error) {
+	body, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &storage.SearchResult{}
+
+	err = c.call("POST", "/api/search/", bytes.NewReader(body), result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Follows new messages that match the query until connection is closed or handler returns error.
+// Stream starts after the message with lastId, empty lastId means that only new messages are received.
+// Empty minLevel means messages of all levels
+func (c *Client) Tail(query, tenant, minLevel, lastId string, handler func(id string, msg *storage.Message) error) error {
+	params := url.Values{}
+	params.Set("query", query)
+
+	if len(tenant) > 0 {
+		params.Set("tenant", tenant)
+	}
+
+	if len(minLevel) > 0 {
+		params.Set("min_level", minLevel)
+	}
+
+	req, err := c.NewRequest("GET", "/api/tail/?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+
+	if len(lastId) > 0 {
+		req.Header.Set("Last-Event-ID", lastId)
+	}
+
+	rs, err := c.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rs.Body.Close() }()
+
+	if rs.StatusCode != http.StatusOK {
+		return decodeResponse(rs, nil)
+	}
+
+	var (
+		id      string
+		data    []string
+		scanner *bufio.Scanner = bufio.NewScanner(rs.Body)
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+
+	// Events are separated by empty line, lines starting with colon are comments
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case len(line) == 0:
+			if len(data) > 0 {
+				msg := &storage.Message{}
+				if err = json.Unmarshal([]byte(strings.Join(data, "\n")), msg); err != nil {
+					return fmt.Errorf("Unable to parse event: %v", err)
+				}
+
+				if err = handler(id, msg); err != nil {
+					return err
+				}
+			}
+
+			data = nil
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+// Sends request and decodes data of the response into result
+func (c *Client) call(method, path string, body io.Reader, result interface{}) error {
+	req, err := c.NewRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+
+	rs, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rs.Body.Close() }()
+
+	return decodeResponse(rs, result)
+}
+
+// Returns request to the server with authorization header
+func (c *Client) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// Decodes response envelope, errors reported by the API are returned as *ApiError
+func decodeResponse(rs *http.Response, result interface{}) error {
+	b, err := ioutil.ReadAll(rs.Body)
+	if err != nil {
+		return err
+	}
+
+	envelope := &response{}
+
+	if err = json.Unmarshal(b, envelope); err != nil {
+		if rs.StatusCode != http.StatusOK {
+			return &ApiError{Code: rs.StatusCode, Message: strings.TrimSpace(string(b))}
+		}
+
+		return fmt.Errorf("Unable to parse response: %v", err)
+	}
+
+	if rs.StatusCode != http.StatusOK || envelope.Status != "ok" {
+		return &ApiError{Code: rs.StatusCode, Message: envelope.Message}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(envelope.Data, result)
+}
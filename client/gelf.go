@@ -0,0 +1,211 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Transport that delivers GELF messages to recause
+type Sender interface {
+	// Sends JSON-encoded GELF message
+	Send(message []byte) error
+	Close() error
+}
+
+const (
+	// Chunk size used by most GELF libraries, fits into ethernet frame
+	DefaultChunkSize int = 1420
+	maxChunks        int = 128
+	chunkHeaderSize  int = 12
+)
+
+var chunkMagic []byte = []byte{0x1e, 0x0f}
+
+// Builds GELF message, extra fields get «_» prefix required by the format
+func NewGelfMessage(host, short, full string, level int, facility string, extra map[string]interface{}) ([]byte, error) {
+	m := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": short,
+		"timestamp":     float64(time.Now().UnixNano()) / float64(time.Second),
+		"level":         level,
+	}
+
+	if len(full) > 0 {
+		m["full_message"] = full
+	}
+
+	if len(facility) > 0 {
+		m["facility"] = facility
+	}
+
+	for key, value := range extra {
+		if !strings.HasPrefix(key, "_") {
+			key = "_" + key
+		}
+
+		m[key] = value
+	}
+
+	return json.Marshal(m)
+}
+
+// Sends messages as UDP datagrams, messages larger than chunk size are split into GELF chunks
+type UdpSender struct {
+	conn      net.Conn
+	chunkSize int
+	compress  bool
+}
+
+// Returns UDP sender, small chunk size allows to test reassembly of chunked messages
+func NewUdpSender(addr string, chunkSize int, compress bool) (*UdpSender, error) {
+	if chunkSize <= chunkHeaderSize {
+		return nil, fmt.Errorf("Chunk size must be greater than %d bytes", chunkHeaderSize)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UdpSender{conn: conn, chunkSize: chunkSize, compress: compress}, nil
+}
+
+func (s *UdpSender) Send(message []byte) error {
+	if s.compress {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+
+		if _, err := gz.Write(message); err != nil {
+			return err
+		}
+
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		message = buf.Bytes()
+	}
+
+	if len(message) <= s.chunkSize {
+		_, err := s.conn.Write(message)
+
+		return err
+	}
+
+	payloadSize := s.chunkSize - chunkHeaderSize
+	nbChunks := (len(message) + payloadSize - 1) / payloadSize
+
+	if nbChunks > maxChunks {
+		return fmt.Errorf("Message of %d bytes needs %d chunks, GELF allows at most %d", len(message), nbChunks, maxChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	for i := 0; i < nbChunks; i++ {
+		end := (i + 1) * payloadSize
+		if end > len(message) {
+			end = len(message)
+		}
+
+		chunk := make([]byte, 0, chunkHeaderSize+end-i*payloadSize)
+		chunk = append(chunk, chunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(nbChunks))
+		chunk = append(chunk, message[i*payloadSize:end]...)
+
+		if _, err := s.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *UdpSender) Close() error {
+	return s.conn.Close()
+}
+
+// Sends messages delimited by null byte through TCP connection, optionally wrapped in TLS
+type TcpSender struct {
+	conn net.Conn
+}
+
+// Returns TCP sender, nil tlsConfig means plain TCP
+func NewTcpSender(addr string, tlsConfig *tls.Config) (*TcpSender, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if tlsConfig != nil {
+		conn, err = tls.Dial("tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TcpSender{conn: conn}, nil
+}
+
+func (s *TcpSender) Send(message []byte) error {
+	if bytes.IndexByte(message, 0) >= 0 {
+		return errors.New("Message contains null byte which is used as delimiter")
+	}
+
+	_, err := s.conn.Write(append(message, 0))
+
+	return err
+}
+
+func (s *TcpSender) Close() error {
+	return s.conn.Close()
+}
+
+// Sends messages to «/api/ingest/», every message is sent in a separate request
+type HttpSender struct {
+	client *Client
+}
+
+func NewHttpSender(c *Client) *HttpSender {
+	return &HttpSender{client: c}
+}
+
+func (s *HttpSender) Send(message []byte) error {
+	_, err := s.client.Ingest(bytes.NewReader(message))
+
+	return err
+}
+
+func (s *HttpSender) Close() error {
+	return nil
+}
+
+// Sends GELF messages delimited by new line to the ingest endpoint, returns number of accepted messages
+func (c *Client) Ingest(body io.Reader) (int, error) {
+	result := &struct {
+		Accepted int `json:"accepted"`
+	}{}
+
+	err := c.call("POST", "/api/ingest/", body, result)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Accepted, nil
+}
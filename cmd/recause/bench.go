@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cc "github.com/urfave/cli"
+
+	"github.com/endeveit/recause/client"
+	"github.com/endeveit/recause/storage"
+)
+
+// Search API is polled with this interval to measure latency
+const benchPollInterval time.Duration = 250 * time.Millisecond
+
+var benchFlags []cc.Flag = append(append([]cc.Flag{
+	cc.IntFlag{
+		Name:  "rate, r",
+		Value: 1000,
+		Usage: "messages per second",
+	},
+	cc.DurationFlag{
+		Name:  "duration, d",
+		Value: 10 * time.Second,
+		Usage: "time to generate traffic",
+	},
+	cc.StringFlag{
+		Name:  "size",
+		Value: "100-1000",
+		Usage: "size of the full message in bytes, uniformly distributed in range «min-max»",
+	},
+	cc.IntFlag{
+		Name:  "hosts",
+		Value: 10,
+		Usage: "number of distinct hosts",
+	},
+	cc.IntFlag{
+		Name:  "fields",
+		Value: 5,
+		Usage: "number of extra fields in every message",
+	},
+	cc.DurationFlag{
+		Name:  "wait",
+		Value: time.Minute,
+		Usage: "maximum time to wait for messages to become searchable after traffic stops",
+	},
+	cc.BoolFlag{
+		Name:  "no-search",
+		Usage: "don't poll search API, only measure sending throughput",
+	},
+}, transportFlags...), clientFlags...)
+
+// Number of messages sent by the moment of time
+type benchCheckpoint struct {
+	sent int
+	at   time.Time
+}
+
+// Progress of the benchmark shared by sender and poller
+type benchState struct {
+	checkpoints []*benchCheckpoint
+	sent        int
+	done        bool
+	mutex       *sync.Mutex
+}
+
+func actionBench(c *cc.Context) error {
+	sizeMin, sizeMax, err := parseSizeRange(c.String("size"))
+	if err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	rate := c.Int("rate")
+	if rate <= 0 || c.Int("hosts") <= 0 {
+		return cc.NewExitError("Rate and number of hosts must be positive", 2)
+	}
+
+	sender, err := newSender(c)
+	if err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+	defer func() { _ = sender.Close() }()
+
+	var (
+		runId   string      = "bench" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		state   *benchState = &benchState{mutex: &sync.Mutex{}}
+		failed  int
+		started time.Time = time.Now()
+		polled  chan *benchReport
+	)
+
+	fmt.Printf("Sending %d msg/s for %s, messages are marked with «%s»\n", rate, c.Duration("duration"), runId)
+
+	if !c.Bool("no-search") {
+		polled = make(chan *benchReport, 1)
+		go pollBench(newClient(c), c.String("tenant"), runId, state, c.Duration("wait"), polled)
+	}
+
+	deadline := started.Add(c.Duration("duration"))
+	lastCheckpoint := started
+
+	for now := time.Now(); now.Before(deadline); now = time.Now() {
+		target := int(now.Sub(started).Seconds() * float64(rate))
+
+		for sent := state.getSent(); sent+failed < target; {
+			msg, err := newBenchMessage(c, runId, sent+failed, sizeMin, sizeMax)
+			if err == nil {
+				err = sender.Send(msg)
+			}
+
+			if err != nil {
+				failed++
+			} else {
+				sent = state.addSent()
+			}
+		}
+
+		if now.Sub(lastCheckpoint) >= benchPollInterval {
+			state.addCheckpoint(now)
+			lastCheckpoint = now
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	state.finish()
+
+	elapsed := time.Now().Sub(started)
+	sent := state.getSent()
+
+	fmt.Printf("Sent %d messages in %s: %.0f msg/s, %d failed\n", sent, elapsed, float64(sent)/elapsed.Seconds(), failed)
+
+	if polled == nil {
+		return nil
+	}
+
+	report := <-polled
+	if report.err != nil {
+		return cc.NewExitError(report.err.Error(), 1)
+	}
+
+	fmt.Print(report.String(sent, started))
+
+	if report.indexed < int64(sent) {
+		return cc.NewExitError(fmt.Sprintf("Only %d of %d messages became searchable", report.indexed, sent), 1)
+	}
+
+	return nil
+}
+
+// Results of search polling
+type benchReport struct {
+	indexed    int64
+	finishedAt time.Time
+	latencies  []time.Duration
+	err        error
+}
+
+func (r *benchReport) String(sent int, started time.Time) string {
+	result := fmt.Sprintf("Searchable %d of %d messages", r.indexed, sent)
+
+	if elapsed := r.finishedAt.Sub(started); r.indexed > 0 && elapsed > 0 {
+		result += fmt.Sprintf(", end-to-end throughput %.0f msg/s", float64(r.indexed)/elapsed.Seconds())
+	}
+
+	result += "\n"
+
+	if len(r.latencies) > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+		percentile := func(p float64) time.Duration {
+			return r.latencies[int(float64(len(r.latencies)-1)*p)]
+		}
+
+		result += fmt.Sprintf("Searchable latency: p50 %s, p95 %s, max %s\n",
+			percentile(0.5), percentile(0.95), r.latencies[len(r.latencies)-1])
+	}
+
+	return result
+}
+
+// Polls search API and measures time between sending messages and their appearance in search results
+func pollBench(api *client.Client, tenant, runId string, state *benchState, wait time.Duration, result chan *benchReport) {
+	var (
+		report     *benchReport         = &benchReport{}
+		q          *storage.SearchQuery = &storage.SearchQuery{Query: runId, Limit: 1, Tenant: tenant}
+		checkpoint int
+		stopAt     time.Time
+	)
+
+	for {
+		rs, err := api.Search(q)
+		if err != nil {
+			report.err = err
+			result <- report
+
+			return
+		}
+
+		now := time.Now()
+		report.indexed = rs.Total
+
+		state.mutex.Lock()
+		for checkpoint < len(state.checkpoints) && rs.Total >= int64(state.checkpoints[checkpoint].sent) {
+			report.latencies = append(report.latencies, now.Sub(state.checkpoints[checkpoint].at))
+			checkpoint++
+		}
+
+		done, sent := state.done, state.sent
+		state.mutex.Unlock()
+
+		if done {
+			if rs.Total >= int64(sent) {
+				report.finishedAt = now
+				result <- report
+
+				return
+			}
+
+			if stopAt.IsZero() {
+				stopAt = now.Add(wait)
+			} else if now.After(stopAt) {
+				report.finishedAt = now
+				result <- report
+
+				return
+			}
+		}
+
+		time.Sleep(benchPollInterval)
+	}
+}
+
+func (s *benchState) getSent() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sent
+}
+
+func (s *benchState) addSent() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sent++
+
+	return s.sent
+}
+
+func (s *benchState) addCheckpoint(at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkpoints = append(s.checkpoints, &benchCheckpoint{sent: s.sent, at: at})
+}
+
+// Marks sending as finished, last checkpoint covers all messages
+func (s *benchState) finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkpoints = append(s.checkpoints, &benchCheckpoint{sent: s.sent, at: time.Now()})
+	s.done = true
+}
+
+// Returns synthetic message, run identifier in the short message allows to find messages of the run
+func newBenchMessage(c *cc.Context, runId string, nb, sizeMin, sizeMax int) ([]byte, error) {
+	const letters string = "abcdefghijklmnopqrstuvwxyz      "
+
+	size := sizeMin
+	if sizeMax > sizeMin {
+		size += rand.Intn(sizeMax - sizeMin + 1)
+	}
+
+	full := make([]byte, size)
+	for i := range full {
+		full[i] = letters[rand.Intn(len(letters))]
+	}
+
+	fields := make(map[string]interface{})
+	for i := 0; i < c.Int("fields"); i++ {
+		fields["field_"+strconv.Itoa(i)] = rand.Intn(1000)
+	}
+
+	return client.NewGelfMessage(
+		fmt.Sprintf("bench-host-%d", rand.Intn(c.Int("hosts"))),
+		fmt.Sprintf("%s message %d", runId, nb),
+		string(full),
+		rand.Intn(8),
+		"bench",
+		fields)
+}
+
+// Parses range like «100-1000», single number means fixed size
+func parseSizeRange(value string) (int, int, error) {
+	parts := strings.SplitN(value, "-", 2)
+
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || min < 0 {
+		return 0, 0, fmt.Errorf("Invalid size range «%s»", value)
+	}
+
+	if len(parts) == 1 {
+		return min, min, nil
+	}
+
+	max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || max < min {
+		return 0, 0, fmt.Errorf("Invalid size range «%s»", value)
+	}
+
+	return min, max, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/endeveit/recause/storage"
+)
+
+// Names of syslog levels used by GELF
+const (
+	colorReset  string = "\x1b[0m"
+	colorRed    string = "\x1b[31m"
+	colorYellow string = "\x1b[33m"
+	colorCyan   string = "\x1b[36m"
+	colorGray   string = "\x1b[90m"
+)
+
+// Writes messages in one of supported formats: table, json, raw or custom template
+type printer struct {
+	format   string
+	color    bool
+	w        io.Writer
+	template *template.Template
+}
+
+// Returns printer, template like «{{.Timestamp}} {{.Host}} {{.ShortMessage}}» overrides format when it isn't empty
+func newPrinter(w io.Writer, format, tmpl string, color bool) (*printer, error) {
+	p := &printer{format: format, color: color, w: w}
+
+	if len(tmpl) > 0 {
+		var err error
+
+		p.template, err = template.New("message").Funcs(template.FuncMap{"level": storage.LevelName}).Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template: %v", err)
+		}
+
+		return p, nil
+	}
+
+	switch format {
+	case "table", "json", "raw":
+	default:
+		return nil, fmt.Errorf("Unknown format «%s», available formats: table, json and raw", format)
+	}
+
+	return p, nil
+}
+
+// Writes single message
+func (p *printer) Print(msg *storage.Message) error {
+	var err error
+
+	if p.template != nil {
+		buf := &bytes.Buffer{}
+
+		if err = p.template.Execute(buf, msg); err == nil {
+			_, err = fmt.Fprintln(p.w, p.colorize(msg.Level, strings.TrimRight(buf.String(), "\n")))
+		}
+
+		return err
+	}
+
+	switch p.format {
+	case "json":
+		var b []byte
+
+		b, err = json.Marshal(msg)
+		if err == nil {
+			_, err = fmt.Fprintf(p.w, "%s\n", b)
+		}
+	case "raw":
+		_, err = fmt.Fprintln(p.w, msg.ShortMessage)
+	default:
+		line := fmt.Sprintf("%s %-7s %-20s %-12s %s",
+			msg.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			storage.LevelName(msg.Level),
+			msg.Host,
+			msg.Facility,
+			strings.Replace(msg.ShortMessage, "\n", " ", -1))
+
+		_, err = fmt.Fprintln(p.w, p.colorize(msg.Level, line))
+	}
+
+	return err
+}
+
+// Wraps text into color of the level
+func (p *printer) colorize(level int32, text string) string {
+	if !p.color {
+		return text
+	}
+
+	var color string
+
+	switch {
+	case level <= 3:
+		color = colorRed
+	case level == 4:
+		color = colorYellow
+	case level == 5:
+		color = colorCyan
+	case level >= 7:
+		color = colorGray
+	default:
+		return text
+	}
+
+	return color + text + colorReset
+}
+
+// Checks if file is a terminal, so colored output is appropriate
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
@@ -4,13 +4,20 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 
-	"github.com/endeveit/go-snippets/config"
+	gc "github.com/robfig/config"
 	cc "github.com/urfave/cli"
 
+	"github.com/endeveit/recause/auth"
+	"github.com/endeveit/recause/config"
 	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/pipeline"
+	"github.com/endeveit/recause/routing"
 	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/bleve"
 	"github.com/endeveit/recause/storage/elastic"
 	"github.com/endeveit/recause/workers"
 )
@@ -29,13 +36,84 @@ func main() {
 	}
 	app.Flags = []cc.Flag{
 		cc.StringFlag{
-			Name:  "config, c",
-			Value: "/etc/recause/config.cfg",
-			Usage: "path to the configuration file",
+			Name:   "config, c",
+			Value:  "/etc/recause/config.cfg",
+			Usage:  "path to the configuration file",
+			EnvVar: "RECAUSE_CONFIG",
 		},
+		cc.StringSliceFlag{
+			Name:  "set",
+			Usage: "override option of the configuration file, e.g. --set http.max_per_page=50",
+		},
+	}
+	app.Before = func(c *cc.Context) error {
+		return config.SetOverrides(c.GlobalStringSlice("set"))
 	}
 
 	app.Action = actionRun
+	app.Commands = []cc.Command{
+		{
+			Name:   "token",
+			Usage:  "generate new API token and print its hash for the tokens file",
+			Action: actionToken,
+		},
+		{
+			Name:      "search",
+			Usage:     "search messages of a running instance",
+			ArgsUsage: "[query]",
+			Flags:     searchFlags,
+			Action:    actionSearch,
+		},
+		{
+			Name:      "tail",
+			Usage:     "follow new messages of a running instance",
+			ArgsUsage: "[query]",
+			Flags:     tailFlags,
+			Action:    actionTail,
+		},
+		{
+			Name:      "send",
+			Usage:     "send test GELF message",
+			ArgsUsage: "<short message>",
+			Flags:     sendFlags,
+			Action:    actionSend,
+		},
+		{
+			Name:   "bench",
+			Usage:  "generate synthetic traffic and measure ingest throughput and searchable latency",
+			Flags:  benchFlags,
+			Action: actionBench,
+		},
+		{
+			Name:   "export",
+			Usage:  "export messages from storage to gzipped NDJSON, e.g. «recause export --from -24h > dump.ndjson.gz»",
+			Flags:  exportFlags,
+			Action: actionExport,
+		},
+		{
+			Name:      "import",
+			Usage:     "import messages exported by «recause export», bleve index must not be used by running instance",
+			ArgsUsage: "<dump.ndjson.gz>",
+			Flags:     importFlags,
+			Action:    actionImport,
+		},
+		{
+			Name:  "config",
+			Usage: "validate or show configuration",
+			Subcommands: []cc.Command{
+				{
+					Name:   "check",
+					Usage:  "validate every section of the configuration file and report all problems",
+					Action: actionConfigCheck,
+				},
+				{
+					Name:   "show",
+					Usage:  "print effective configuration with defaults applied and secrets masked",
+					Action: actionConfigShow,
+				},
+			},
+		},
+	}
 
 	err := app.Run(os.Args)
 	if err != nil {
@@ -49,6 +127,8 @@ func actionRun(c *cc.Context) error {
 	var (
 		wg          *sync.WaitGroup = &sync.WaitGroup{}
 		die         chan bool       = make(chan bool)
+		storageDie  chan bool       = make(chan bool)
+		flushed     chan bool       = make(chan bool)
 		storage     storage.Storage
 		workersList []workers.Worker
 	)
@@ -65,12 +145,71 @@ func actionRun(c *cc.Context) error {
 		}
 	}()
 
-	storage = elastic.NewElasticStorage()
-	go storage.PeriodicFlush(die)
+	// Router creates backends used by routes and sends every message to one of them
+	router, err := routing.New(config.Instance(), backendName(config.Instance()), newStorage)
+	if err != nil {
+		return cc.NewExitError(fmt.Sprintf("Unable to configure routing: %v", err), 1)
+	}
+
+	logger.Instance().
+		WithField("routes", strings.Join(router.Names(), ", ")).
+		Info("Routing configured")
+
+	processors, err := pipeline.New(config.Instance())
+	if err != nil {
+		return cc.NewExitError(fmt.Sprintf("Unable to configure pipeline: %v", err), 1)
+	}
+
+	if processors.Len() > 0 {
+		logger.Instance().
+			WithField("processors", processors.Len()).
+			Info("Processing pipeline configured")
+	}
+
+	config.RegisterReloadable("pipeline.processors", "processor:*.*")
+
+	multiline, err := pipeline.NewMultiline(config.Instance())
+	if err != nil {
+		return cc.NewExitError(fmt.Sprintf("Unable to configure multiline reassembly: %v", err), 1)
+	}
+
+	config.RegisterReloadable("multiline.*")
+
+	// Receivers get storage that reassembles multiline messages and passes them through the pipeline
+	storage = pipeline.Wrap(router, processors, multiline)
+
+	// Storage is stopped after workers, so messages they received are flushed too
+	go func() {
+		storage.PeriodicFlush(storageDie)
+		close(flushed)
+	}()
 
 	workersList = append(workersList, workers.NewWorkerHttp(storage))
 	workersList = append(workersList, workers.NewWorkerReceiver(storage))
 
+	if tcpReceiver := workers.NewWorkerTcpReceiver(storage); tcpReceiver != nil {
+		workersList = append(workersList, tcpReceiver)
+	}
+
+	// Listen for SIGHUP and reload settings of storage and workers
+	reloadables := []config.Reloadable{config.ReloadFunc(logger.PrepareReload), processors, multiline, router}
+
+	for _, w := range workersList {
+		if r, ok := w.(config.Reloadable); ok {
+			reloadables = append(reloadables, r)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logger.Instance().Info("Caught hangup signal, reloading configuration")
+
+			reloadConfig(reloadables)
+		}
+	}()
+
 	wg.Add(len(workersList))
 
 	for _, w := range workersList {
@@ -79,5 +218,165 @@ func actionRun(c *cc.Context) error {
 
 	wg.Wait()
 
+	close(storageDie)
+	<-flushed
+
+	return nil
+}
+
+// Returns storage backend, backend from config is used when name is empty
+func newStorage(backend string) (storage.Storage, error) {
+	if len(backend) == 0 {
+		backend = backendName(config.Instance())
+	}
+
+	switch backend {
+	case "elastic":
+		return elastic.NewElasticStorage(), nil
+	case "bleve":
+		return bleve.NewBleveStorage(), nil
+	}
+
+	return nil, fmt.Errorf("Unknown storage backend «%s»", backend)
+}
+
+// Returns name of the primary storage backend
+func backendName(c *gc.Config) string {
+	backend, err := c.String("storage", "backend")
+	if err != nil || len(backend) == 0 {
+		return "elastic"
+	}
+
+	return backend
+}
+
+func actionToken(c *cc.Context) error {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("token = %s\nhash = %s\n", token, auth.HashToken(token))
+
+	return nil
+}
+
+// Re-reads config file and applies new settings to all components at once.
+// If config is invalid or any component rejects it, the old config stays active
+func reloadConfig(reloadables []config.Reloadable) {
+	c, err := config.Read(config.Filename())
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Error("Unable to read configuration file, old configuration is kept")
+
+		return
+	}
+
+	appliers := []func(){}
+
+	for _, r := range reloadables {
+		apply, err := r.PrepareReload(c)
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				Error("New configuration is invalid, old configuration is kept")
+
+			return
+		}
+
+		appliers = append(appliers, apply)
+	}
+
+	changes := config.Diff(config.Instance(), c)
+
+	config.Replace(c)
+
+	for _, apply := range appliers {
+		apply()
+	}
+
+	for _, change := range changes {
+		entry := logger.Instance().
+			WithField("section", change.Section).
+			WithField("option", change.Option)
+
+		if change.Reloadable {
+			entry.Info("Setting is changed")
+		} else {
+			entry.Warning("Setting is changed, but new value requires restart")
+		}
+	}
+
+	logger.Instance().
+		WithField("changed", len(changes)).
+		Info("Configuration is reloaded")
+}
+
+func actionConfigCheck(c *cc.Context) error {
+	filename := c.GlobalString("config")
+	problems := config.Check(filename)
+
+	// Contents of the tokens file, processors, routes and multiline patterns are checked only when the file itself is valid
+	if len(problems) == 0 {
+		if cfg, err := config.Read(filename); err == nil {
+			if _, err := pipeline.New(cfg); err != nil {
+				problems = append(problems, &config.Problem{
+					Section: "pipeline",
+					Option:  "processors",
+					Message: err.Error(),
+				})
+			}
+
+			if err := routing.Check(cfg, backendName(cfg)); err != nil {
+				problems = append(problems, &config.Problem{
+					Section: "routing",
+					Message: err.Error(),
+				})
+			}
+
+			if _, err := pipeline.NewMultiline(cfg); err != nil {
+				problems = append(problems, &config.Problem{
+					Section: "multiline",
+					Message: err.Error(),
+				})
+			}
+
+			if tokensFile, _ := cfg.String("auth", "tokens_file"); len(tokensFile) > 0 {
+				if _, err := auth.LoadTokens(tokensFile); err != nil {
+					problems = append(problems, &config.Problem{
+						Section: "auth",
+						Option:  "tokens_file",
+						Message: fmt.Sprintf("file «%s» is invalid: %v", tokensFile, err),
+					})
+				}
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("%s: OK\n", filename)
+
+		return nil
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("%s: %s\n", filename, problem)
+	}
+
+	return cc.NewExitError(fmt.Sprintf("Found %d problem(s) in %s", len(problems), filename), 1)
+}
+
+func actionConfigShow(c *cc.Context) error {
+	filename := c.GlobalString("config")
+
+	cfg, err := config.Read(filename)
+	if err != nil {
+		return cc.NewExitError(fmt.Sprintf("Unable to read %s: %v", filename, err), 1)
+	}
+
+	fmt.Printf("; Effective configuration read from %s\n", filename)
+	config.Show(cfg, os.Stdout)
+
 	return nil
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cc "github.com/urfave/cli"
+
+	"github.com/endeveit/recause/client"
+	"github.com/endeveit/recause/storage"
+)
+
+// Flags shared by subcommands that talk to a running instance
+var clientFlags []cc.Flag = []cc.Flag{
+	cc.StringFlag{
+		Name:   "server, s",
+		Value:  "http://127.0.0.1:8094",
+		Usage:  "URL of the recause HTTP API",
+		EnvVar: "RECAUSE_SERVER",
+	},
+	cc.StringFlag{
+		Name:   "token, t",
+		Usage:  "API token",
+		EnvVar: "RECAUSE_TOKEN",
+	},
+	cc.StringFlag{
+		Name:  "tenant",
+		Usage: "tenant which messages are used, only admin tokens without own tenant may choose it",
+	},
+}
+
+// Flags that control output of messages
+var outputFlags []cc.Flag = []cc.Flag{
+	cc.StringFlag{
+		Name:  "format, f",
+		Value: "table",
+		Usage: "output format: table, json (one message per line) or raw (short message only)",
+	},
+	cc.StringFlag{
+		Name:  "template",
+		Usage: "Go template of the output line, e.g. «{{.Timestamp}} {{level .Level}} {{.Host}} {{.ShortMessage}}»",
+	},
+	cc.BoolFlag{
+		Name:  "no-color",
+		Usage: "disable colors even if output is a terminal",
+	},
+}
+
+var levelFlag cc.Flag = cc.StringFlag{
+	Name:  "min-level",
+	Usage: "the least severe level of messages, name like «warning» or syslog number",
+}
+
+var searchFlags []cc.Flag = append(append([]cc.Flag{
+	levelFlag,
+	cc.StringFlag{
+		Name:  "from",
+		Usage: "start of the time range: relative, e.g. «-1h» or «last 15m», or RFC3339 time",
+	},
+	cc.StringFlag{
+		Name:  "to",
+		Usage: "end of the time range in RFC3339 format, ignored when «--from» is relative",
+	},
+	cc.IntFlag{
+		Name:  "limit, n",
+		Value: 100,
+		Usage: "maximum number of messages, several pages are requested if the server limits page size",
+	},
+}, outputFlags...), clientFlags...)
+
+// Returns API client configured by flags of the subcommand
+func newClient(c *cc.Context) *client.Client {
+	return client.NewClient(c.String("server"), c.String("token"))
+}
+
+func actionSearch(c *cc.Context) error {
+	p, err := newPrinter(os.Stdout, c.String("format"), c.String("template"), isTerminal(os.Stdout) && !c.Bool("no-color"))
+	if err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	q := &storage.SearchQuery{
+		Query:    strings.Join(c.Args(), " "),
+		Tenant:   c.String("tenant"),
+		MinLevel: c.String("min-level"),
+	}
+
+	if err = setQueryRange(q, c.String("from"), c.String("to")); err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	var (
+		api     *client.Client = newClient(c)
+		limit   int            = c.Int("limit")
+		printed int
+	)
+
+	// Follow pages until limit is reached, server may return less messages than requested per page
+	for printed < limit {
+		q.Offset = printed
+		q.Limit = limit - printed
+
+		result, err := api.Search(q)
+		if err != nil {
+			return cc.NewExitError(err.Error(), 1)
+		}
+
+		for i := range result.Messages {
+			if err = p.Print(&result.Messages[i]); err != nil {
+				return cc.NewExitError(err.Error(), 1)
+			}
+		}
+
+		printed += len(result.Messages)
+
+		// Server moves offset back when it exceeds «max_results», so next pages would repeat messages
+		if len(result.Messages) == 0 || result.Offset != q.Offset || int64(printed) >= result.Total {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Sets time range of the query from flag values
+func setQueryRange(q *storage.SearchQuery, from, to string) error {
+	if len(from) > 0 {
+		if t, err := time.Parse(time.RFC3339, from); err == nil {
+			q.From = t
+		} else if _, err = storage.ParseRelativeRange(from); err == nil {
+			q.Range = from
+		} else {
+			return fmt.Errorf("Invalid value «%s» of «--from»: %v", from, err)
+		}
+	}
+
+	if len(to) > 0 {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return fmt.Errorf("Invalid value «%s» of «--to»: %v", to, err)
+		}
+
+		q.To = t
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	cc "github.com/urfave/cli"
+
+	"github.com/endeveit/recause/client"
+)
+
+// Flags that describe how messages are delivered
+var transportFlags []cc.Flag = []cc.Flag{
+	cc.StringFlag{
+		Name:  "proto, p",
+		Value: "udp",
+		Usage: "transport: udp, udp-chunked (forces GELF chunking), tcp or http",
+	},
+	cc.StringFlag{
+		Name:  "addr, a",
+		Value: "127.0.0.1:12201",
+		Usage: "address of the UDP or TCP receiver, HTTP uses «--server»",
+	},
+	cc.IntFlag{
+		Name:  "chunk-size",
+		Value: client.DefaultChunkSize,
+		Usage: "maximum size of UDP datagram, udp-chunked uses 256 bytes unless this is set",
+	},
+	cc.BoolFlag{
+		Name:  "gzip",
+		Usage: "compress UDP messages",
+	},
+	cc.BoolFlag{
+		Name:  "tls",
+		Usage: "wrap TCP connection in TLS",
+	},
+	cc.BoolFlag{
+		Name:  "insecure",
+		Usage: "don't verify certificate of the TCP receiver",
+	},
+}
+
+var sendFlags []cc.Flag = append(append([]cc.Flag{
+	cc.StringFlag{
+		Name:  "host",
+		Usage: "host of the message, defaults to hostname",
+	},
+	cc.StringFlag{
+		Name:  "full",
+		Usage: "full message",
+	},
+	cc.IntFlag{
+		Name:  "level, l",
+		Value: 6,
+		Usage: "syslog level of the message",
+	},
+	cc.StringFlag{
+		Name:  "facility",
+		Usage: "facility of the message",
+	},
+	cc.StringSliceFlag{
+		Name:  "field, F",
+		Usage: "extra field in format key=value, numeric values are sent as numbers",
+	},
+	cc.IntFlag{
+		Name:  "count, n",
+		Value: 1,
+		Usage: "number of messages to send",
+	},
+}, transportFlags...), clientFlags...)
+
+// Returns sender for the transport chosen by flags
+func newSender(c *cc.Context) (client.Sender, error) {
+	switch c.String("proto") {
+	case "udp":
+		return client.NewUdpSender(c.String("addr"), c.Int("chunk-size"), c.Bool("gzip"))
+	case "udp-chunked":
+		chunkSize := c.Int("chunk-size")
+		if !c.IsSet("chunk-size") {
+			chunkSize = 256
+		}
+
+		return client.NewUdpSender(c.String("addr"), chunkSize, c.Bool("gzip"))
+	case "tcp":
+		var tlsConfig *tls.Config
+
+		if c.Bool("tls") {
+			tlsConfig = &tls.Config{InsecureSkipVerify: c.Bool("insecure")}
+		}
+
+		return client.NewTcpSender(c.String("addr"), tlsConfig)
+	case "http":
+		return client.NewHttpSender(newClient(c)), nil
+	}
+
+	return nil, fmt.Errorf("Unknown transport «%s», available transports: udp, udp-chunked, tcp and http", c.String("proto"))
+}
+
+// Parses «key=value» fields
+func parseFields(values []string) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("Field «%s» must be in format key=value", value)
+		}
+
+		if number, err := strconv.ParseFloat(parts[1], 64); err == nil {
+			result[parts[0]] = number
+		} else {
+			result[parts[0]] = parts[1]
+		}
+	}
+
+	return result, nil
+}
+
+func actionSend(c *cc.Context) error {
+	short := strings.Join(c.Args(), " ")
+	if len(short) == 0 {
+		return cc.NewExitError("Short message is required", 2)
+	}
+
+	fields, err := parseFields(c.StringSlice("field"))
+	if err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	host := c.String("host")
+	if len(host) == 0 {
+		host, _ = os.Hostname()
+	}
+
+	message, err := client.NewGelfMessage(host, short, c.String("full"), c.Int("level"), c.String("facility"), fields)
+	if err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+
+	sender, err := newSender(c)
+	if err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+	defer func() { _ = sender.Close() }()
+
+	for i := 0; i < c.Int("count"); i++ {
+		if err = sender.Send(message); err != nil {
+			return cc.NewExitError(err.Error(), 1)
+		}
+	}
+
+	fmt.Printf("Sent %d message(s) through %s\n", c.Int("count"), c.String("proto"))
+
+	return nil
+}
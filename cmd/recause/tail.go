@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cc "github.com/urfave/cli"
+
+	"github.com/endeveit/recause/client"
+	"github.com/endeveit/recause/storage"
+)
+
+// Maximum delay between reconnection attempts
+const maxReconnectDelay time.Duration = 30 * time.Second
+
+var tailFlags []cc.Flag = append(append([]cc.Flag{levelFlag}, outputFlags...), clientFlags...)
+
+func actionTail(c *cc.Context) error {
+	p, err := newPrinter(os.Stdout, c.String("format"), c.String("template"), isTerminal(os.Stdout) && !c.Bool("no-color"))
+	if err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	var (
+		api      *client.Client = newClient(c)
+		query    string         = strings.Join(c.Args(), " ")
+		lastId   string
+		delay    time.Duration = time.Second
+		printErr error
+	)
+
+	for {
+		err = api.Tail(query, c.String("tenant"), c.String("min-level"), lastId, func(id string, msg *storage.Message) error {
+			lastId = id
+			// Connection works again, so next reconnect starts with short delay
+			delay = time.Second
+			printErr = p.Print(msg)
+
+			return printErr
+		})
+
+		// Output is closed, e.g. by «head», so there is no reason to continue
+		if printErr != nil {
+			return cc.NewExitError(printErr.Error(), 1)
+		}
+
+		// Errors of the request itself won't disappear after reconnect
+		if apiErr, ok := err.(*client.ApiError); ok && apiErr.Code < 500 {
+			return cc.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Stream is interrupted: %v, reconnecting in %s\n", err, delay)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	cc "github.com/urfave/cli"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+// Maximum size of a single message in the dump
+const maxDumpLineSize int = 16 * 1024 * 1024
+
+var exportFlags []cc.Flag = []cc.Flag{
+	cc.StringFlag{
+		Name:  "backend, b",
+		Usage: "storage backend to read messages from, defaults to the one from config",
+	},
+	cc.StringFlag{
+		Name:  "from",
+		Usage: "start of the time range: relative, e.g. «-24h», or RFC3339 time",
+	},
+	cc.StringFlag{
+		Name:  "to",
+		Usage: "end of the time range in RFC3339 format",
+	},
+	cc.StringFlag{
+		Name:  "tenant",
+		Usage: "tenant which messages are exported, defaults to the default tenant",
+	},
+	cc.StringFlag{
+		Name:  "query, q",
+		Usage: "export only messages matching the query",
+	},
+	cc.StringFlag{
+		Name:  "output, o",
+		Usage: "file to write gzipped NDJSON to, standard output is used by default",
+	},
+	cc.StringFlag{
+		Name:  "checkpoint",
+		Usage: "file to store progress in, export continues from it when the file exists",
+	},
+	cc.IntFlag{
+		Name:  "batch",
+		Value: 500,
+		Usage: "number of messages read at once",
+	},
+}
+
+var importFlags []cc.Flag = []cc.Flag{
+	cc.StringFlag{
+		Name:  "backend, b",
+		Usage: "storage backend to write messages to, defaults to the one from config",
+	},
+	cc.StringFlag{
+		Name:  "tenant",
+		Usage: "tenant of imported messages, tenant stored in the dump is used by default",
+	},
+	cc.StringFlag{
+		Name:  "checkpoint",
+		Usage: "file to store progress in, import skips already imported messages when the file exists",
+	},
+	cc.IntFlag{
+		Name:  "batch",
+		Value: 500,
+		Usage: "number of messages written at once",
+	},
+}
+
+// Progress of the export. Messages are read ordered by timestamp, so the export continues from the second
+// of the last exported message skipping messages of that second that were already exported
+type exportCheckpoint struct {
+	From     time.Time `json:"from"`
+	Skip     int       `json:"skip"`
+	Exported int64     `json:"exported"`
+}
+
+// Progress of the import
+type importCheckpoint struct {
+	Imported int64 `json:"imported"`
+}
+
+func actionExport(c *cc.Context) error {
+	_ = config.Instance(c.GlobalString("config"))
+
+	st, err := newStorage(c.String("backend"))
+	if err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	q := &storage.SearchQuery{
+		Query:     c.String("query"),
+		Tenant:    c.String("tenant"),
+		Ascending: true,
+	}
+
+	if err = setQueryRange(q, c.String("from"), c.String("to")); err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	if err = q.ResolveRange(time.Now()); err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	if len(q.Tenant) == 0 {
+		q.Tenant = storage.DefaultTenant()
+	}
+
+	checkpoint := &exportCheckpoint{From: q.From}
+	if err = readCheckpoint(c.String("checkpoint"), checkpoint); err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+
+	var output io.Writer = os.Stdout
+
+	if len(c.String("output")) > 0 {
+		// Resumed export is appended, concatenated gzip streams are read as one
+		f, err := os.OpenFile(c.String("output"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return cc.NewExitError(err.Error(), 1)
+		}
+		defer func() { _ = f.Close() }()
+
+		output = f
+	}
+
+	started := time.Now()
+
+	for {
+		q.From = checkpoint.From
+		q.Offset = checkpoint.Skip
+		q.Limit = c.Int("batch")
+
+		result, err := st.GetMessages(q)
+		if err != nil {
+			return cc.NewExitError(fmt.Sprintf("Unable to read messages: %v", err), 1)
+		}
+
+		if len(result.Messages) == 0 {
+			break
+		}
+
+		// Every batch is a separate gzip member, so interrupted export leaves at most one broken batch
+		gz := gzip.NewWriter(output)
+		encoder := json.NewEncoder(gz)
+
+		for i := range result.Messages {
+			msg := &result.Messages[i]
+
+			if err = encoder.Encode(msg); err != nil {
+				return cc.NewExitError(err.Error(), 1)
+			}
+
+			second := msg.Timestamp.Truncate(time.Second)
+			if second.Equal(checkpoint.From) {
+				checkpoint.Skip++
+			} else {
+				checkpoint.From = second
+				checkpoint.Skip = 1
+			}
+
+			checkpoint.Exported++
+		}
+
+		// Checkpoint must not get ahead of the data that reached the output
+		if err = gz.Close(); err != nil {
+			return cc.NewExitError(err.Error(), 1)
+		}
+
+		if err = writeCheckpoint(c.String("checkpoint"), checkpoint); err != nil {
+			return cc.NewExitError(err.Error(), 1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported %d messages, reached %s\n", checkpoint.Exported, checkpoint.From.Format(time.RFC3339))
+	}
+
+	fmt.Fprintf(os.Stderr, "Export finished: %d messages in %s\n", checkpoint.Exported, time.Now().Sub(started))
+
+	return nil
+}
+
+func actionImport(c *cc.Context) error {
+	_ = config.Instance(c.GlobalString("config"))
+
+	if len(c.Args()) != 1 {
+		return cc.NewExitError("Path to the dump is required, use «-» to read standard input", 2)
+	}
+
+	tenant := c.String("tenant")
+	if err := storage.ValidateTenantName(tenant); err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	st, err := newStorage(c.String("backend"))
+	if err != nil {
+		return cc.NewExitError(err.Error(), 2)
+	}
+
+	input, err := openDump(c.Args().First())
+	if err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+	defer func() { _ = input.Close() }()
+
+	checkpoint := &importCheckpoint{}
+	if err = readCheckpoint(c.String("checkpoint"), checkpoint); err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+
+	var (
+		scanner  *bufio.Scanner = bufio.NewScanner(input)
+		batch    []*storage.Message
+		position int64
+		started  time.Time = time.Now()
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), maxDumpLineSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := st.ImportMessages(batch); err != nil {
+			return fmt.Errorf("Unable to import messages: %v", err)
+		}
+
+		checkpoint.Imported += int64(len(batch))
+		batch = batch[:0]
+
+		if err := writeCheckpoint(c.String("checkpoint"), checkpoint); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Imported %d messages\n", checkpoint.Imported)
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		position++
+
+		// Messages imported by previous run
+		if position <= checkpoint.Imported {
+			continue
+		}
+
+		msg := &storage.Message{}
+		if err = json.Unmarshal(scanner.Bytes(), msg); err != nil {
+			return cc.NewExitError(fmt.Sprintf("Unable to parse message on line %d: %v", position, err), 1)
+		}
+
+		if len(tenant) > 0 {
+			msg.Tenant = tenant
+		}
+
+		batch = append(batch, msg)
+
+		if len(batch) >= c.Int("batch") {
+			if err = flush(); err != nil {
+				return cc.NewExitError(err.Error(), 1)
+			}
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+
+	if err = flush(); err != nil {
+		return cc.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Import finished: %d messages in %s\n", checkpoint.Imported, time.Now().Sub(started))
+
+	return nil
+}
+
+// Opens dump file, gzipped and plain NDJSON are supported
+func openDump(filename string) (io.ReadCloser, error) {
+	var f *os.File = os.Stdin
+
+	if filename != "-" {
+		var err error
+
+		f, err = os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reader := bufio.NewReader(f)
+
+	magic, err := reader.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return struct {
+			io.Reader
+			io.Closer
+		}{reader, f}, nil
+	}
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// Reads checkpoint if file exists, missing file means that process starts from scratch
+func readCheckpoint(filename string, checkpoint interface{}) error {
+	if len(filename) == 0 {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(b, checkpoint); err != nil {
+		return fmt.Errorf("Checkpoint file %s is corrupted: %v", filename, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Resuming from checkpoint %s\n", filename)
+
+	return nil
+}
+
+// Atomically replaces checkpoint file
+func writeCheckpoint(filename string, checkpoint interface{}) error {
+	if len(filename) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(filename+".tmp", b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
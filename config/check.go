@@ -0,0 +1,207 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	gc "github.com/robfig/config"
+)
+
+// Problem found in the config file
+type Problem struct {
+	// Line of the file, zero if the problem isn't bound to a line
+	Line    int
+	Section string
+	Option  string
+	Message string
+}
+
+func (p *Problem) String() string {
+	location := ""
+
+	switch {
+	case len(p.Option) > 0:
+		location = fmt.Sprintf("[%s] %s: ", p.Section, p.Option)
+	case len(p.Section) > 0:
+		location = fmt.Sprintf("[%s]: ", p.Section)
+	}
+
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s%s", p.Line, location, p.Message)
+	}
+
+	return location + p.Message
+}
+
+var (
+	reSectionLine *regexp.Regexp = regexp.MustCompile(`^\[([^\]]+)\]`)
+	reOptionLine  *regexp.Regexp = regexp.MustCompile(`^([^\s=:;#]+)\s*[=:]`)
+)
+
+// Positions of sections and options in the file
+type lineIndex map[string]int
+
+// Returns line of the option, line of its section if option isn't in the file
+func (li lineIndex) find(section, option string) int {
+	if line, ok := li[section+"."+option]; ok {
+		return line
+	}
+
+	return li[section]
+}
+
+// Scans file for lines where sections and options are declared
+func indexLines(filename string) (lineIndex, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var (
+		result  lineIndex = make(lineIndex)
+		section string    = gc.DEFAULT_SECTION
+		line    int
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+
+		if m := reSectionLine.FindStringSubmatch(text); m != nil {
+			section = strings.TrimSpace(m[1])
+			result[section] = line
+		} else if m := reOptionLine.FindStringSubmatch(text); m != nil {
+			result[section+"."+m[1]] = line
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+// Validates all sections of the config file and returns every problem found
+func Check(filename string) []*Problem {
+	lines, err := indexLines(filename)
+	if err != nil {
+		return []*Problem{{Message: err.Error()}}
+	}
+
+	c, err := Read(filename)
+	if err != nil {
+		return []*Problem{{Message: err.Error()}}
+	}
+
+	return checkConfig(c, lines)
+}
+
+// Validates parsed config, lines are used to point to the problems
+func checkConfig(c *gc.Config, lines lineIndex) []*Problem {
+	var problems []*Problem
+
+	report := func(section, option, format string, args ...interface{}) {
+		problem := &Problem{
+			Line:    lines.find(section, option),
+			Section: section,
+			Option:  option,
+			Message: fmt.Sprintf(format, args...),
+		}
+
+		// Overridden value doesn't come from the file, so line would be misleading
+		if source := Source(section, option); len(option) > 0 && len(source) > 0 {
+			problem.Line = 0
+			problem.Message += " (" + source + ")"
+		}
+
+		problems = append(problems, problem)
+	}
+
+	for _, section := range c.Sections() {
+		if section == gc.DEFAULT_SECTION {
+			continue
+		}
+
+		if !IsKnownSection(section) {
+			report(section, "", "unknown section")
+
+			continue
+		}
+
+		options, _ := c.SectionOptions(section)
+		for _, name := range options {
+			option := FindOption(section, name)
+			if option == nil {
+				report(section, name, "unknown option")
+
+				continue
+			}
+
+			value, err := c.String(section, name)
+			if err != nil {
+				report(section, name, "%v", err)
+
+				continue
+			}
+
+			if err := option.Validate(strings.TrimSpace(value)); err != nil {
+				report(section, name, "%v", err)
+			}
+		}
+	}
+
+	requireValue := func(section, option, reason string) {
+		if value, _ := c.String(section, option); len(strings.TrimSpace(value)) == 0 {
+			report(section, option, "value is required %s", reason)
+		}
+	}
+
+	backend, _ := Effective(c, "storage", FindOption("storage", "backend"))
+	switch backend {
+	case "elastic":
+		requireValue("elastic", "url", "by elastic backend")
+		requireValue("elastic", "index", "by elastic backend")
+		requireValue("elastic", "type", "by elastic backend")
+	case "bleve":
+		requireValue("bleve", "datapath", "by bleve backend")
+	}
+
+	requireValue("http", "addr", "to start HTTP server")
+	requireValue("receiver", "addr", "to start GELF receiver")
+
+	// Logger fails to start when these options are missing, but they may be empty
+	for _, option := range []string{"addr", "level", "proto"} {
+		if !c.HasOption("syslog", option) {
+			report("syslog", option, "option is required, leave it empty to use default")
+		}
+	}
+
+	for _, section := range []string{"http", "receiver_tcp"} {
+		cert, _ := c.String(section, "tls_cert")
+		if len(strings.TrimSpace(cert)) == 0 {
+			continue
+		}
+
+		requireValue(section, "tls_key", "when «tls_cert» is set")
+
+		clientAuth, _ := Effective(c, section, FindOption(section, "tls_client_auth"))
+		if clientAuth != "none" {
+			requireValue(section, "tls_client_ca", "to verify client certificates")
+		}
+	}
+
+	maxPerPage, _ := c.Int("http", "max_per_page")
+	maxResults, _ := c.Int("http", "max_results")
+	if maxPerPage > 0 && maxResults > 0 && maxPerPage > maxResults {
+		report("http", "max_results", "must not be less than «max_per_page»")
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems
+}
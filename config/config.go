@@ -0,0 +1,206 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/endeveit/go-snippets/cli"
+	gc "github.com/robfig/config"
+)
+
+// Component which settings may be changed without restart
+type Reloadable interface {
+	// Reads and validates settings from the new config, returned function applies them
+	PrepareReload(*gc.Config) (func(), error)
+}
+
+// Adapter that allows to use ordinary function as Reloadable
+type ReloadFunc func(*gc.Config) (func(), error)
+
+func (f ReloadFunc) PrepareReload(c *gc.Config) (func(), error) {
+	return f(c)
+}
+
+// Option that differs between two configs
+type Change struct {
+	Section    string
+	Option     string
+	Reloadable bool
+}
+
+var (
+	once       sync.Once
+	mutex      *sync.RWMutex = &sync.RWMutex{}
+	current    *gc.Config
+	filename   string
+	reloadable []string
+
+	errNoFilename error = errors.New("Path to the configuration file is not provided")
+)
+
+// Returns instance of config object, file is read on the first call
+func Instance(filenames ...string) *gc.Config {
+	once.Do(func() {
+		if len(filenames) == 0 {
+			cli.CheckFatalError(errNoFilename)
+		}
+
+		c, err := Read(filenames[0])
+		cli.CheckFatalError(err)
+
+		filename = filenames[0]
+		current = c
+	})
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return current
+}
+
+// Returns path to the config file
+func Filename() string {
+	return filename
+}
+
+// Reads config from file and applies environment variables and flags that override its options
+func Read(filename string) (*gc.Config, error) {
+	c, err := gc.ReadDefault(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	applyOverrides(c)
+
+	return c, nil
+}
+
+// Replaces current config
+func Replace(c *gc.Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current = c
+}
+
+// Marks options as reloadable, patterns are matched against «section.option», e.g. «tenant:*.retention»
+func RegisterReloadable(patterns ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	reloadable = append(reloadable, patterns...)
+}
+
+// Checks if option may be changed without restart
+func IsReloadable(section, option string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, pattern := range reloadable {
+		if ok, err := path.Match(pattern, section+"."+option); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns list of options that were added, removed or changed
+func Diff(old, new *gc.Config) []*Change {
+	var (
+		keys   map[string]*Change = make(map[string]*Change)
+		result []*Change          = []*Change{}
+	)
+
+	values := func(c *gc.Config) map[string]string {
+		result := make(map[string]string)
+
+		for _, section := range c.Sections() {
+			options, err := c.SectionOptions(section)
+			if err != nil {
+				continue
+			}
+
+			for _, option := range options {
+				value, _ := c.RawString(section, option)
+				result[section+"\x00"+option] = value
+				keys[section+"\x00"+option] = &Change{Section: section, Option: option}
+			}
+		}
+
+		return result
+	}
+
+	oldValues := values(old)
+	newValues := values(new)
+
+	names := []string{}
+	for name := range keys {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldValue, oldOk := oldValues[name]
+		newValue, newOk := newValues[name]
+
+		if oldOk != newOk || oldValue != newValue {
+			change := keys[name]
+			change.Reloadable = IsReloadable(change.Section, change.Option)
+			result = append(result, change)
+		}
+	}
+
+	return result
+}
+
+// Returns trimmed value of the option, missing option is returned as empty string
+func Value(c *gc.Config, section, name string) string {
+	value, err := c.String(section, name)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// Splits comma-separated list, empty items are skipped
+func SplitList(value string) (result []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// Parses positive period like «90s», «720h», «30d» or «2w», time.ParseDuration doesn't know anything about days and weeks
+func ParsePeriod(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(value, suffix) {
+			nb, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+			if err != nil || nb <= 0 {
+				return 0, fmt.Errorf("«%s» is not a positive period", value)
+			}
+
+			return time.Duration(nb) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("«%s» is not a positive period", value)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	gc "github.com/robfig/config"
+)
+
+// Prefix of environment variables that override options of the config file
+const ENV_PREFIX string = "RECAUSE_"
+
+// Values passed by «--set section.key=value» flags, keyed by «section.key»
+var flagOverrides map[string]string = make(map[string]string)
+
+// Parses values of «--set» flags, they override both config file and environment variables
+func SetOverrides(values []string) error {
+	overrides := make(map[string]string)
+
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Override «%s» must be in format section.key=value", value)
+		}
+
+		key := strings.TrimSpace(parts[0])
+
+		dot := strings.Index(key, ".")
+		if dot <= 0 || dot == len(key)-1 {
+			return fmt.Errorf("Override «%s» must be in format section.key=value", value)
+		}
+
+		if FindOption(key[:dot], key[dot+1:]) == nil {
+			return fmt.Errorf("Unknown option «%s» in override", key)
+		}
+
+		overrides[key] = strings.TrimSpace(parts[1])
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	flagOverrides = overrides
+
+	return nil
+}
+
+// Returns name of environment variable that overrides the option, e.g. RECAUSE_HTTP_MAX_PER_PAGE
+func EnvName(section, option string) string {
+	sanitize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+
+			return '_'
+		}, strings.ToUpper(s))
+	}
+
+	return ENV_PREFIX + sanitize(section) + "_" + sanitize(option)
+}
+
+// Describes where value of the option comes from if it is overridden, empty string otherwise
+func Source(section, option string) string {
+	mutex.RLock()
+	_, ok := flagOverrides[section+"."+option]
+	mutex.RUnlock()
+
+	if ok {
+		return "flag --set " + section + "." + option
+	}
+
+	if _, ok := os.LookupEnv(EnvName(section, option)); ok {
+		return "env " + EnvName(section, option)
+	}
+
+	return ""
+}
+
+// Applies environment variables and then «--set» flags on top of values read from file
+func applyOverrides(c *gc.Config) {
+	for _, o := range Schema {
+		for _, section := range expandSection(c, o.Section) {
+			if value, ok := os.LookupEnv(EnvName(section, o.Name)); ok {
+				c.AddOption(section, o.Name, value)
+			}
+		}
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for key, value := range flagOverrides {
+		dot := strings.Index(key, ".")
+		c.AddOption(key[:dot], key[dot+1:], value)
+	}
+}
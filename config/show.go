@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	gc "github.com/robfig/config"
+)
+
+// Writes effective configuration: every known option with its value or default, secrets are masked.
+// Comment after the value tells where it comes from
+func Show(c *gc.Config, w io.Writer) {
+	var (
+		printed map[string]bool = make(map[string]bool)
+		first   bool            = true
+	)
+
+	fmt.Fprintln(w, "; Precedence: --set section.key=value flags, then "+ENV_PREFIX+"<SECTION>_<KEY> environment variables,")
+	fmt.Fprintln(w, "; then config file, then defaults. Variables of «tenant:<name>» sections, e.g. "+EnvName("tenant:acme", "quota")+",")
+	fmt.Fprintln(w, "; apply only to sections present in the file")
+	fmt.Fprintln(w)
+
+	for _, o := range Schema {
+		if printed[o.Section] {
+			continue
+		}
+
+		printed[o.Section] = true
+
+		for _, section := range expandSection(c, o.Section) {
+			if !first {
+				fmt.Fprintln(w)
+			}
+
+			first = false
+
+			fmt.Fprintf(w, "[%s]\n", section)
+
+			for _, option := range Schema {
+				if option.Section != o.Section {
+					continue
+				}
+
+				if option.Name == "*" {
+					showArbitrary(c, section, option, w)
+
+					continue
+				}
+
+				value, isDefault := Effective(c, section, option)
+
+				// Sections like «processor:*» describe options of different kinds, unused ones are not shown
+				if section != option.Section && len(value) == 0 {
+					continue
+				}
+				line := strings.TrimSpace(fmt.Sprintf("%s = %s", option.Name, option.Display(value)))
+
+				if source := Source(section, option.Name); len(source) > 0 {
+					line += " ; " + source
+				} else if isDefault {
+					line += " ; default"
+				}
+
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+}
+
+// Returns sections of the config that match pattern of the schema, plain section is returned as is
+func expandSection(c *gc.Config, pattern string) []string {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}
+	}
+
+	result := []string{}
+	for _, section := range c.Sections() {
+		if matchSection(pattern, section) {
+			result = append(result, section)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// Writes options of the section that have arbitrary names
+func showArbitrary(c *gc.Config, section string, o *Option, w io.Writer) {
+	names, _ := c.SectionOptions(section)
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, _ := c.String(section, name)
+		fmt.Fprintln(w, strings.TrimSpace(fmt.Sprintf("%s = %s", name, o.Display(strings.TrimSpace(value)))))
+	}
+}
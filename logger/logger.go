@@ -1,26 +1,28 @@
 package logger
 
 import (
+	"fmt"
 	"log/syslog"
 	"sync"
+	"sync/atomic"
 
 	log "github.com/Sirupsen/logrus"
 	logrus_syslog "github.com/Sirupsen/logrus/hooks/syslog"
 	"github.com/endeveit/go-snippets/cli"
-	"github.com/endeveit/go-snippets/config"
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
 )
 
 var (
-	once   sync.Once
-	logger *log.Logger
+	once sync.Once
+	// Logger is replaced on reload instead of being changed, logrus reads its level without synchronization
+	current atomic.Value
 )
 
 func initLogger() {
 	once.Do(func() {
-		var (
-			level syslog.Priority
-			hook  *logrus_syslog.SyslogHook
-		)
+		var hook *logrus_syslog.SyslogHook
 
 		proto, err := config.Instance().String("syslog", "proto")
 		cli.CheckFatalError(err)
@@ -31,29 +33,11 @@ func initLogger() {
 		levelName, err := config.Instance().String("syslog", "level")
 		cli.CheckFatalError(err)
 
-		switch levelName {
-		case "debug":
-			level = syslog.LOG_DEBUG
-		case "info":
-			level = syslog.LOG_INFO
-		case "notice":
-			level = syslog.LOG_NOTICE
-		case "warning":
-			level = syslog.LOG_WARNING
-		case "err":
-			level = syslog.LOG_ERR
-		case "crit":
-			level = syslog.LOG_CRIT
-		case "alert":
-			level = syslog.LOG_ALERT
-		case "emerg":
-			level = syslog.LOG_EMERG
-		default:
-			level = syslog.LOG_WARNING
-		}
+		// Unknown level falls back to warning, reload reports it as an error
+		priority, level, _ := getLevel(levelName)
 
 		if len(proto) == 0 || len(addr) == 0 {
-			writer, err := syslog.New(level, "recause")
+			writer, err := syslog.New(priority, "recause")
 			if err != nil {
 				cli.CheckFatalError(err)
 			}
@@ -62,14 +46,19 @@ func initLogger() {
 				Writer: writer,
 			}
 		} else {
-			hook, err = logrus_syslog.NewSyslogHook(proto, addr, level, "recause")
+			hook, err = logrus_syslog.NewSyslogHook(proto, addr, priority, "recause")
 			cli.CheckFatalError(err)
 		}
 
-		logger = log.New()
+		logger := log.New()
 		logger.Hooks.Add(hook)
+		logger.Level = level
 
 		log.SetOutput(logger.Writer())
+
+		current.Store(logger)
+
+		config.RegisterReloadable("syslog.level")
 	})
 }
 
@@ -77,5 +66,53 @@ func initLogger() {
 func Instance() *log.Logger {
 	initLogger()
 
-	return logger
+	return current.Load().(*log.Logger)
+}
+
+// Reads log level from the new config, returned function applies it
+func PrepareReload(c *gc.Config) (func(), error) {
+	levelName, err := c.String("syslog", "level")
+	if err != nil {
+		return nil, err
+	}
+
+	_, level, err := getLevel(levelName)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		previous := Instance()
+
+		current.Store(&log.Logger{
+			Out:       previous.Out,
+			Hooks:     previous.Hooks,
+			Formatter: previous.Formatter,
+			Level:     level,
+		})
+	}, nil
+}
+
+// Returns syslog priority and logrus level that correspond to the level name
+func getLevel(name string) (syslog.Priority, log.Level, error) {
+	switch name {
+	case "debug":
+		return syslog.LOG_DEBUG, log.DebugLevel, nil
+	case "info":
+		return syslog.LOG_INFO, log.InfoLevel, nil
+	case "notice":
+		return syslog.LOG_NOTICE, log.InfoLevel, nil
+	case "warning":
+		return syslog.LOG_WARNING, log.WarnLevel, nil
+	case "err":
+		return syslog.LOG_ERR, log.ErrorLevel, nil
+	case "crit":
+		return syslog.LOG_CRIT, log.FatalLevel, nil
+	case "alert":
+		return syslog.LOG_ALERT, log.FatalLevel, nil
+	case "emerg":
+		return syslog.LOG_EMERG, log.FatalLevel, nil
+	}
+
+	return syslog.LOG_WARNING, log.WarnLevel, fmt.Errorf("Unknown log level «%s»", name)
 }
@@ -0,0 +1,391 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets suitable for latencies measured in seconds
+var DefaultBuckets []float64 = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Buckets suitable for batch sizes
+var SizeBuckets []float64 = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// Metric that can be exported in Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	mutexRegistry *sync.Mutex          = &sync.Mutex{}
+	registry      map[string]collector = make(map[string]collector)
+	// Prometheus text format escapes only these characters in label values, other bytes are written as is
+	labelEscaper *strings.Replacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// Adds metric to the registry, metric with the same name is returned if it already exists
+func register(c collector) collector {
+	mutexRegistry.Lock()
+	defer mutexRegistry.Unlock()
+
+	if existing, ok := registry[c.name()]; ok {
+		return existing
+	}
+
+	registry[c.name()] = c
+
+	return c
+}
+
+// Writes all registered metrics in Prometheus text format
+func WriteText(w io.Writer) error {
+	mutexRegistry.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, registry[name])
+	}
+	mutexRegistry.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Monotonically increasing value partitioned by labels
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+	mutex      *sync.Mutex
+	values     map[string]*Counter
+}
+
+type Counter struct {
+	labelValues []string
+	mutex       *sync.Mutex
+	value       float64
+}
+
+// Returns counter registered with provided name
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return register(&CounterVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		mutex:      &sync.Mutex{},
+		values:     make(map[string]*Counter),
+	}).(*CounterVec)
+}
+
+// Returns counter for provided label values
+func (cv *CounterVec) With(labelValues ...string) *Counter {
+	key := strings.Join(labelValues, "\xff")
+
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	if c, ok := cv.values[key]; ok {
+		return c
+	}
+
+	c := &Counter{labelValues: labelValues, mutex: &sync.Mutex{}}
+	cv.values[key] = c
+
+	return c
+}
+
+// Increments counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Increments counter by provided value
+func (c *Counter) Add(value float64) {
+	c.mutex.Lock()
+	c.value += value
+	c.mutex.Unlock()
+}
+
+func (cv *CounterVec) name() string {
+	return cv.metricName
+}
+
+func (cv *CounterVec) write(w io.Writer) {
+	writeHeader(w, cv.metricName, cv.help, "counter")
+
+	for _, c := range cv.sorted() {
+		c.mutex.Lock()
+		value := c.value
+		c.mutex.Unlock()
+
+		fmt.Fprintf(w, "%s%s %s\n", cv.metricName, formatLabels(cv.labels, c.labelValues, "", ""), formatValue(value))
+	}
+}
+
+func (cv *CounterVec) sorted() []*Counter {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	keys := make([]string, 0, len(cv.values))
+	for key := range cv.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	result := make([]*Counter, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, cv.values[key])
+	}
+
+	return result
+}
+
+// Value that is calculated when metrics are collected
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+// Returns gauge which value is returned by the function
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return register(&GaugeFunc{
+		metricName: name,
+		help:       help,
+		fn:         fn,
+	}).(*GaugeFunc)
+}
+
+func (g *GaugeFunc) name() string {
+	return g.metricName
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatValue(g.fn()))
+}
+
+// Values calculated when metrics are collected, partitioned by labels
+type GaugeFuncVec struct {
+	metricName string
+	help       string
+	labels     []string
+	mutex      *sync.Mutex
+	values     map[string]*gaugeFuncValue
+}
+
+type gaugeFuncValue struct {
+	labelValues []string
+	fn          func() float64
+}
+
+// Returns gauge registered with provided name
+func NewGaugeFuncVec(name, help string, labels ...string) *GaugeFuncVec {
+	return register(&GaugeFuncVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		mutex:      &sync.Mutex{},
+		values:     make(map[string]*gaugeFuncValue),
+	}).(*GaugeFuncVec)
+}
+
+// Sets function which returns value for provided label values, previous function is replaced
+func (gv *GaugeFuncVec) Set(fn func() float64, labelValues ...string) {
+	gv.mutex.Lock()
+	defer gv.mutex.Unlock()
+
+	gv.values[strings.Join(labelValues, "\xff")] = &gaugeFuncValue{labelValues: labelValues, fn: fn}
+}
+
+func (gv *GaugeFuncVec) name() string {
+	return gv.metricName
+}
+
+func (gv *GaugeFuncVec) write(w io.Writer) {
+	writeHeader(w, gv.metricName, gv.help, "gauge")
+
+	gv.mutex.Lock()
+	keys := make([]string, 0, len(gv.values))
+	for key := range gv.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	values := make([]*gaugeFuncValue, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, gv.values[key])
+	}
+	gv.mutex.Unlock()
+
+	for _, v := range values {
+		fmt.Fprintf(w, "%s%s %s\n", gv.metricName, formatLabels(gv.labels, v.labelValues, "", ""), formatValue(v.fn()))
+	}
+}
+
+// Distribution of observed values partitioned by labels
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+	mutex      *sync.Mutex
+	values     map[string]*Histogram
+}
+
+type Histogram struct {
+	labelValues []string
+	buckets     []float64
+	mutex       *sync.Mutex
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Returns histogram registered with provided name
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return register(&HistogramVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		mutex:      &sync.Mutex{},
+		values:     make(map[string]*Histogram),
+	}).(*HistogramVec)
+}
+
+// Returns histogram for provided label values
+func (hv *HistogramVec) With(labelValues ...string) *Histogram {
+	key := strings.Join(labelValues, "\xff")
+
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	if h, ok := hv.values[key]; ok {
+		return h
+	}
+
+	h := &Histogram{
+		labelValues: labelValues,
+		buckets:     hv.buckets,
+		mutex:       &sync.Mutex{},
+		counts:      make([]uint64, len(hv.buckets)),
+	}
+	hv.values[key] = h
+
+	return h
+}
+
+// Adds value to the distribution
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+// Adds time elapsed since start in seconds
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Now().Sub(start).Seconds())
+}
+
+func (hv *HistogramVec) name() string {
+	return hv.metricName
+}
+
+func (hv *HistogramVec) write(w io.Writer) {
+	writeHeader(w, hv.metricName, hv.help, "histogram")
+
+	hv.mutex.Lock()
+	keys := make([]string, 0, len(hv.values))
+	for key := range hv.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	histograms := make([]*Histogram, 0, len(keys))
+	for _, key := range keys {
+		histograms = append(histograms, hv.values[key])
+	}
+	hv.mutex.Unlock()
+
+	for _, h := range histograms {
+		h.mutex.Lock()
+
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n",
+				hv.metricName, formatLabels(hv.labels, h.labelValues, "le", formatValue(bound)), h.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", hv.metricName, formatLabels(hv.labels, h.labelValues, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.metricName, formatLabels(hv.labels, h.labelValues, "", ""), formatValue(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.metricName, formatLabels(hv.labels, h.labelValues, "", ""), h.count)
+
+		h.mutex.Unlock()
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.Replace(help, "\n", " ", -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// Returns labels in format {name="value",...}, extra label is appended when its name is not empty
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	pairs := []string{}
+
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+
+		pairs = append(pairs, name+"=\""+labelEscaper.Replace(value)+"\"")
+	}
+
+	if len(extraName) > 0 {
+		pairs = append(pairs, extraName+"=\""+labelEscaper.Replace(extraValue)+"\"")
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
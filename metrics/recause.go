@@ -0,0 +1,70 @@
+package metrics
+
+// Metrics exported by recause
+var (
+	MessagesReceived *CounterVec = NewCounterVec(
+		"recause_messages_received_total",
+		"Number of messages read by receivers, including invalid ones",
+		"receiver")
+	MessagesParsed *CounterVec = NewCounterVec(
+		"recause_messages_parsed_total",
+		"Number of messages successfully parsed by receivers",
+		"receiver")
+	MessagesDropped *CounterVec = NewCounterVec(
+		"recause_messages_dropped_total",
+		"Number of messages dropped before they reached storage",
+		"receiver", "reason")
+
+	MessagesRouted *CounterVec = NewCounterVec(
+		"recause_messages_routed_total",
+		"Number of messages sent to storage by route",
+		"route")
+
+	ProcessorErrors *CounterVec = NewCounterVec(
+		"recause_processor_errors_total",
+		"Number of messages that processor of the pipeline failed to process",
+		"processor")
+	ProcessorDropped *CounterVec = NewCounterVec(
+		"recause_processor_dropped_total",
+		"Number of messages dropped by processor of the pipeline",
+		"processor")
+	Redactions *CounterVec = NewCounterVec(
+		"recause_redactions_total",
+		"Number of values replaced by redaction processors",
+		"processor", "rule")
+
+	FlushDuration *HistogramVec = NewHistogramVec(
+		"recause_flush_duration_seconds",
+		"Time spent writing batch of messages to storage",
+		DefaultBuckets,
+		"backend")
+	FlushBatchSize *HistogramVec = NewHistogramVec(
+		"recause_flush_batch_size",
+		"Number of messages written to storage at once",
+		SizeBuckets,
+		"backend")
+	FlushFailures *CounterVec = NewCounterVec(
+		"recause_flush_failures_total",
+		"Number of messages that storage failed to write",
+		"backend", "reason")
+	BufferMessages *GaugeFuncVec = NewGaugeFuncVec(
+		"recause_buffer_messages",
+		"Number of messages waiting to be written to storage",
+		"backend")
+
+	SearchDuration *HistogramVec = NewHistogramVec(
+		"recause_search_duration_seconds",
+		"Time spent searching messages in storage",
+		DefaultBuckets,
+		"backend")
+
+	HttpRequests *CounterVec = NewCounterVec(
+		"recause_http_requests_total",
+		"Number of processed HTTP requests",
+		"route", "code")
+	HttpDuration *HistogramVec = NewHistogramVec(
+		"recause_http_request_duration_seconds",
+		"Time spent processing HTTP requests",
+		DefaultBuckets,
+		"route")
+)
@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+const (
+	defaultDedupWindow  time.Duration = time.Minute
+	defaultDedupMaxKeys int           = 100000
+	defaultDedupFields  string        = "timestamp, host, facility, level, short_message, full_message"
+	repeatCountField    string        = "extra.repeat_count"
+	// Maximum size of messages held for collapsing
+	defaultDedupMaxHeldBytes int = 64 * 1024 * 1024
+)
+
+// Drops messages which content was already seen during the window.
+// With collapsing the first message is stored again with number of repeats when the window ends,
+// it has the same identifier, so the stored message is replaced
+type dedupProcessor struct {
+	fields   []string
+	window   time.Duration
+	maxKeys  int
+	collapse bool
+	// Approximate size of held messages, the oldest entries are forgotten when it exceeds the limit
+	heldBytes    int
+	maxHeldBytes int
+	// Entries ordered by the time they were seen last, the oldest go first
+	order   *list.List
+	entries map[[sha1.Size]byte]*list.Element
+	// Collapsed messages of forgotten entries, they are emitted with summaries
+	ready []*storage.Message
+	mutex *sync.Mutex
+}
+
+type dedupEntry struct {
+	key  [sha1.Size]byte
+	seen time.Time
+	// The first message, kept only when repeats are collapsed
+	msg     *storage.Message
+	size    int
+	repeats int64
+}
+
+func newDedupProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &dedupProcessor{
+		fields:       config.SplitList(config.Value(c, section, "fields")),
+		window:       defaultDedupWindow,
+		maxKeys:      defaultDedupMaxKeys,
+		order:        list.New(),
+		entries:      make(map[[sha1.Size]byte]*list.Element),
+		mutex:        &sync.Mutex{},
+		maxHeldBytes: defaultDedupMaxHeldBytes,
+	}
+
+	if len(p.fields) == 0 {
+		p.fields = config.SplitList(defaultDedupFields)
+	}
+
+	var err error
+
+	if value := config.Value(c, section, "window"); len(value) > 0 {
+		if p.window, err = time.ParseDuration(value); err != nil || p.window <= 0 {
+			return nil, fmt.Errorf("option «window» must be a positive duration")
+		}
+	}
+
+	if value := config.Value(c, section, "max_keys"); len(value) > 0 {
+		if p.maxKeys, err = strconv.Atoi(value); err != nil || p.maxKeys <= 0 {
+			return nil, fmt.Errorf("option «max_keys» must be a positive integer")
+		}
+	}
+
+	if value := config.Value(c, section, "max_held_bytes"); len(value) > 0 {
+		if p.maxHeldBytes, err = strconv.Atoi(value); err != nil || p.maxHeldBytes <= 0 {
+			return nil, fmt.Errorf("option «max_held_bytes» must be a positive integer")
+		}
+	}
+
+	switch collapse := config.Value(c, section, "collapse"); collapse {
+	case "", "off":
+	case "on":
+		p.collapse = true
+	default:
+		return nil, fmt.Errorf("option «collapse» must be on or off")
+	}
+
+	return p, nil
+}
+
+func (p *dedupProcessor) Process(msg *storage.Message) (bool, error) {
+	// Messages of different tenants are never duplicates of each other
+	key := sha1.Sum([]byte(msg.Tenant + "\xff" + fieldsKey(msg, p.fields)))
+	now := time.Now()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Window slides, every repeat extends it
+	if element, ok := p.entries[key]; ok {
+		entry := element.Value.(*dedupEntry)
+
+		if now.Sub(entry.seen) < p.window {
+			entry.seen = now
+			entry.repeats++
+			p.order.MoveToBack(element)
+
+			return false, nil
+		}
+
+		p.remove(element)
+	}
+
+	if p.order.Len() >= p.maxKeys {
+		p.remove(p.order.Front())
+	}
+
+	entry := &dedupEntry{key: key, seen: now}
+
+	if p.collapse {
+		// Identifier is fixed before other processors change the message, the collapsed copy reuses it
+		if len(msg.Id) == 0 {
+			msg.Id = storage.MessageId(msg)
+		}
+
+		entry.msg = msg
+		entry.size = messageSize(msg)
+
+		for p.order.Len() > 0 && p.heldBytes+entry.size > p.maxHeldBytes {
+			p.remove(p.order.Front())
+		}
+
+		p.heldBytes += entry.size
+	}
+
+	p.entries[key] = p.order.PushBack(entry)
+
+	return true, nil
+}
+
+// Returns collapsed messages of windows that ended by now and of evicted entries
+func (p *dedupProcessor) summaries(now time.Time) []*storage.Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for element := p.order.Front(); element != nil; element = p.order.Front() {
+		if now.Sub(element.Value.(*dedupEntry).seen) < p.window {
+			break
+		}
+
+		p.remove(element)
+	}
+
+	result := p.ready
+	p.ready = nil
+
+	return result
+}
+
+// Forgets the entry, its collapsed message is queued if there were repeats
+func (p *dedupProcessor) remove(element *list.Element) {
+	entry := p.order.Remove(element).(*dedupEntry)
+	delete(p.entries, entry.key)
+	p.heldBytes -= entry.size
+
+	if entry.msg == nil || entry.repeats == 0 {
+		return
+	}
+
+	// Stored message may be read by the backend at the moment, so it is copied instead of changed
+	msg := *entry.msg
+	msg.Extra = make(map[string]interface{}, len(entry.msg.Extra)+1)
+
+	for k, v := range entry.msg.Extra {
+		msg.Extra[k] = v
+	}
+
+	if err := msg.SetField(repeatCountField, entry.repeats+1); err == nil {
+		p.ready = append(p.ready, &msg)
+	}
+}
+
+// Returns approximate size of the message in memory
+func messageSize(msg *storage.Message) int {
+	size := len(msg.Id) + len(msg.Version) + len(msg.Host) + len(msg.ShortMessage) + len(msg.FullMessage) +
+		len(msg.Facility) + len(msg.File) + len(msg.Tenant) + 128
+
+	for key, value := range msg.Extra {
+		size += len(key) + len(fmt.Sprint(value)) + 32
+	}
+
+	return size
+}
@@ -0,0 +1,440 @@
+package pipeline
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/storage"
+)
+
+const (
+	defaultGeoipCacheSize int           = 10000
+	defaultDnsTtl         time.Duration = time.Hour
+	// Interval of checking database files for updates
+	geoipWatchInterval time.Duration = 10 * time.Second
+	// Maximum number of reverse DNS lookups running at once, messages of other senders aren't annotated until
+	// their lookups are done
+	maxDnsLookups int    = 16
+	senderPrefix  string = "sender_"
+)
+
+// Databases are shared by processors and kept open, so reload of the pipeline doesn't open files again
+var (
+	geoipDatabases map[string]*geoipDatabase = make(map[string]*geoipDatabase)
+	geoipMutex     *sync.Mutex               = &sync.Mutex{}
+)
+
+// Fields of GeoIP2 and GeoLite2 City, Country and ASN databases
+type geoipRecord struct {
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// MaxMind database file which is reopened when the file changes
+type geoipDatabase struct {
+	path     string
+	reader   *maxminddb.Reader
+	modified time.Time
+	// Incremented on every reopening, so processors know that cached results are outdated
+	version int64
+	mutex   *sync.RWMutex
+}
+
+// Returns open database, the file is opened on first use
+func openGeoipDatabase(path string) (*geoipDatabase, error) {
+	geoipMutex.Lock()
+	defer geoipMutex.Unlock()
+
+	if db, ok := geoipDatabases[path]; ok {
+		return db, nil
+	}
+
+	db := &geoipDatabase{path: path, mutex: &sync.RWMutex{}}
+	if err := db.open(); err != nil {
+		return nil, err
+	}
+
+	geoipDatabases[path] = db
+
+	go db.watch()
+
+	return db, nil
+}
+
+// Opens the file and replaces current reader with the new one
+func (db *geoipDatabase) open() error {
+	stat, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+
+	reader, err := maxminddb.Open(db.path)
+	if err != nil {
+		return fmt.Errorf("unable to open database «%s»: %v", db.path, err)
+	}
+
+	db.mutex.Lock()
+	previous := db.reader
+	db.reader = reader
+	db.modified = stat.ModTime()
+	db.mutex.Unlock()
+
+	atomic.AddInt64(&db.version, 1)
+
+	if previous != nil {
+		_ = previous.Close()
+	}
+
+	return nil
+}
+
+// Reopens the file when it is replaced, e.g. by geoipupdate. Old database is used if the new one is broken
+func (db *geoipDatabase) watch() {
+	for range time.Tick(geoipWatchInterval) {
+		stat, err := os.Stat(db.path)
+		if err != nil || stat.ModTime().Equal(db.getModified()) {
+			continue
+		}
+
+		if err = db.open(); err != nil {
+			logger.Instance().
+				WithError(err).
+				Warning("Unable to reload GeoIP database")
+
+			continue
+		}
+
+		logger.Instance().
+			WithField("path", db.path).
+			Info("GeoIP database reloaded")
+	}
+}
+
+func (db *geoipDatabase) getModified() time.Time {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.modified
+}
+
+// Adds data of the address to the record, addresses missing in the database leave it as is
+func (db *geoipDatabase) lookup(ip net.IP, record *geoipRecord) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.reader.Lookup(ip, record)
+}
+
+// Adds location and autonomous system of IP addresses from local MaxMind databases
+// and optionally reverse DNS name of the sender
+type geoipProcessor struct {
+	fields    []string
+	prefix    string
+	databases []*geoipDatabase
+	// Sender address is annotated too
+	sender bool
+	dns    *dnsCache
+	// Results of lookups by addresses, cache is cleared when it's full or databases are reloaded
+	cache        map[string]map[string]interface{}
+	cacheSize    int
+	cacheVersion int64
+	mutex        *sync.Mutex
+}
+
+func newGeoipProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &geoipProcessor{
+		fields:    config.SplitList(config.Value(c, section, "fields")),
+		prefix:    config.Value(c, section, "prefix"),
+		cacheSize: defaultGeoipCacheSize,
+		cache:     make(map[string]map[string]interface{}),
+		mutex:     &sync.Mutex{},
+	}
+
+	// Prefix of several fields would mix their data
+	if len(p.prefix) > 0 && len(p.fields) > 1 {
+		return nil, fmt.Errorf("option «prefix» can be used with single field only")
+	}
+
+	for _, path := range config.SplitList(config.Value(c, section, "database")) {
+		db, err := openGeoipDatabase(path)
+		if err != nil {
+			return nil, err
+		}
+
+		p.databases = append(p.databases, db)
+	}
+
+	if len(p.fields) > 0 && len(p.databases) == 0 {
+		return nil, fmt.Errorf("option «database» is required to look up fields")
+	}
+
+	switch sender := config.Value(c, section, "sender"); sender {
+	case "", "off":
+	case "on":
+		p.sender = true
+	default:
+		return nil, fmt.Errorf("option «sender» must be on or off")
+	}
+
+	if len(p.fields) == 0 && !p.sender {
+		return nil, fmt.Errorf("option «fields» is required unless «sender» is on")
+	}
+
+	switch reverseDns := config.Value(c, section, "reverse_dns"); reverseDns {
+	case "", "off":
+	case "on":
+		if !p.sender {
+			return nil, fmt.Errorf("option «reverse_dns» requires «sender» to be on")
+		}
+
+		ttl := defaultDnsTtl
+		if value := config.Value(c, section, "dns_ttl"); len(value) > 0 {
+			var err error
+			if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("option «dns_ttl» must be a positive duration")
+			}
+		}
+
+		p.dns = newDnsCache(ttl)
+	default:
+		return nil, fmt.Errorf("option «reverse_dns» must be on or off")
+	}
+
+	if value := config.Value(c, section, "cache_size"); len(value) > 0 {
+		var err error
+		if p.cacheSize, err = strconv.Atoi(value); err != nil || p.cacheSize <= 0 {
+			return nil, fmt.Errorf("option «cache_size» must be a positive integer")
+		}
+	}
+
+	if p.dns != nil {
+		p.dns.maxSize = p.cacheSize
+	}
+
+	return p, nil
+}
+
+func (p *geoipProcessor) Process(msg *storage.Message) (bool, error) {
+	for _, field := range p.fields {
+		value, ok := msg.Field(field)
+		if !ok {
+			continue
+		}
+
+		prefix := p.prefix
+		if len(prefix) == 0 {
+			prefix = strings.TrimPrefix(strings.TrimPrefix(field, "extra."), "_") + "_"
+		}
+
+		if err := p.annotate(msg, fmt.Sprint(value), prefix); err != nil {
+			return true, fmt.Errorf("field «%s»: %v", field, err)
+		}
+	}
+
+	if !p.sender || len(msg.Sender) == 0 {
+		return true, nil
+	}
+
+	if err := msg.SetField("extra."+senderPrefix+"ip", msg.Sender); err != nil {
+		return true, err
+	}
+
+	if p.dns != nil {
+		if host, ok := p.dns.lookup(msg.Sender, time.Now()); ok && len(host) > 0 {
+			if err := msg.SetField("extra."+senderPrefix+"host", host); err != nil {
+				return true, err
+			}
+		}
+	}
+
+	if len(p.databases) == 0 {
+		return true, nil
+	}
+
+	return true, p.annotate(msg, msg.Sender, senderPrefix)
+}
+
+// Sets fields with data of the address, e.g. «client_ip_country_code»
+func (p *geoipProcessor) annotate(msg *storage.Message, address, prefix string) error {
+	fields, err := p.lookup(strings.TrimSpace(address))
+	if err != nil {
+		return err
+	}
+
+	for name, value := range fields {
+		if err = msg.SetField("extra."+prefix+name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns fields found in databases for the address
+func (p *geoipProcessor) lookup(address string) (map[string]interface{}, error) {
+	var version int64
+
+	for _, db := range p.databases {
+		version += atomic.LoadInt64(&db.version)
+	}
+
+	p.mutex.Lock()
+	if p.cacheVersion != version {
+		p.cache = make(map[string]map[string]interface{})
+		p.cacheVersion = version
+	}
+
+	fields, ok := p.cache[address]
+	p.mutex.Unlock()
+
+	if ok {
+		return fields, nil
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("«%s» is not an IP address", address)
+	}
+
+	record := &geoipRecord{}
+	for _, db := range p.databases {
+		if err := db.lookup(ip, record); err != nil {
+			return nil, err
+		}
+	}
+
+	fields = record.fields()
+
+	p.mutex.Lock()
+	if len(p.cache) >= p.cacheSize {
+		p.cache = make(map[string]map[string]interface{})
+	}
+
+	p.cache[address] = fields
+	p.mutex.Unlock()
+
+	return fields, nil
+}
+
+// Returns non-empty fields of the record
+func (r *geoipRecord) fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	if len(r.Country.IsoCode) > 0 {
+		fields["country_code"] = r.Country.IsoCode
+	}
+
+	if name := r.Country.Names["en"]; len(name) > 0 {
+		fields["country"] = name
+	}
+
+	if name := r.City.Names["en"]; len(name) > 0 {
+		fields["city"] = name
+	}
+
+	if r.AutonomousSystemNumber > 0 {
+		fields["asn"] = r.AutonomousSystemNumber
+	}
+
+	if len(r.AutonomousSystemOrganization) > 0 {
+		fields["as_org"] = r.AutonomousSystemOrganization
+	}
+
+	return fields
+}
+
+// Names of addresses resolved in background, so slow DNS doesn't delay messages.
+// Messages of the sender get its name after the lookup is done
+type dnsCache struct {
+	ttl     time.Duration
+	maxSize int
+	entries map[string]*dnsEntry
+	running chan bool
+	mutex   *sync.Mutex
+}
+
+type dnsEntry struct {
+	host    string
+	expires time.Time
+	// Lookup is running
+	pending bool
+}
+
+func newDnsCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		maxSize: defaultGeoipCacheSize,
+		entries: make(map[string]*dnsEntry),
+		running: make(chan bool, maxDnsLookups),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Returns name of the address, false if it isn't known yet. Addresses without names are cached too
+func (c *dnsCache) lookup(address string, now time.Time) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[address]
+	if ok && (entry.pending || now.Before(entry.expires)) {
+		return entry.host, !entry.pending
+	}
+
+	if len(c.entries) >= c.maxSize {
+		for key, e := range c.entries {
+			if !e.pending && !now.Before(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+
+		if len(c.entries) >= c.maxSize {
+			return "", false
+		}
+	}
+
+	select {
+	case c.running <- true:
+	default:
+		// Too many lookups are running, the address is resolved with one of next messages
+		return "", false
+	}
+
+	c.entries[address] = &dnsEntry{pending: true}
+
+	go c.resolve(address)
+
+	return "", false
+}
+
+func (c *dnsCache) resolve(address string) {
+	var host string
+
+	if names, err := net.LookupAddr(address); err == nil && len(names) > 0 {
+		host = strings.TrimSuffix(names[0], ".")
+	}
+
+	<-c.running
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[address] = &dnsEntry{host: host, expires: time.Now().Add(c.ttl)}
+}
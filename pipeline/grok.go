@@ -0,0 +1,316 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+// Reference to the pattern: %{NAME}, %{NAME:field} or %{NAME:field:type}
+var reGrokReference *regexp.Regexp = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?(?::(int|float|string|bool))?\}`)
+
+// Patterns referencing each other deeper than this are considered recursive
+const maxGrokDepth int = 32
+
+var (
+	onceGrok        sync.Once
+	bundledPatterns map[string]string
+)
+
+// Extracts fields from the text field of the message using grok pattern or regular expression
+// with named groups. Captured values are written to extra fields
+type grokProcessor struct {
+	field    string
+	re       *regexp.Regexp
+	captures []*grokCapture
+	// Tag added to messages that don't match, empty means that messages are not tagged
+	tag string
+}
+
+// Group of the regular expression and the field it is written to
+type grokCapture struct {
+	group   int
+	field   string
+	convert string
+}
+
+// Returns processor of «grok» or «regex» type
+func newGrokProcessor(c *gc.Config, section, kind string) (Processor, error) {
+	p := &grokProcessor{
+		field: config.Value(c, section, "field"),
+		tag:   config.Value(c, section, "tag_on_failure"),
+	}
+
+	if len(p.field) == 0 {
+		p.field = "short_message"
+	}
+
+	switch p.tag {
+	case "":
+		p.tag = kind + "_failure"
+	case "none":
+		p.tag = ""
+	}
+
+	pattern := config.Value(c, section, "pattern")
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("option «pattern» is required")
+	}
+
+	var (
+		expr  string = pattern
+		named map[string]string
+		err   error
+	)
+
+	if kind == "grok" {
+		patterns, err := loadGrokPatterns(c, config.Value(c, section, "patterns_file"))
+		if err != nil {
+			return nil, err
+		}
+
+		expr, named, err = expandGrok(pattern, patterns)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.re, err = regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	types, err := parseTypes(config.Value(c, section, "types"))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, group := range p.re.SubexpNames() {
+		if len(group) == 0 {
+			continue
+		}
+
+		capture := &grokCapture{group: i, field: group}
+
+		// Grok captures use generated group names, field and type come from the pattern
+		if kind == "grok" {
+			if spec, ok := named[group]; !ok {
+				continue
+			} else if parts := strings.SplitN(spec, ":", 2); len(parts) == 2 {
+				capture.field, capture.convert = parts[0], parts[1]
+			} else {
+				capture.field = spec
+			}
+		}
+
+		if convert, ok := types[capture.field]; ok {
+			capture.convert = convert
+		}
+
+		p.captures = append(p.captures, capture)
+	}
+
+	if len(p.captures) == 0 {
+		return nil, fmt.Errorf("pattern doesn't capture any fields")
+	}
+
+	return p, nil
+}
+
+func (p *grokProcessor) Process(msg *storage.Message) (bool, error) {
+	value, ok := msg.Field(p.field)
+	if !ok {
+		return true, p.fail(msg, fmt.Errorf("Field «%s» is missing", p.field))
+	}
+
+	text := fmt.Sprint(value)
+
+	loc := p.re.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return true, p.fail(msg, fmt.Errorf("Field «%s» doesn't match the pattern", p.field))
+	}
+
+	var firstErr error
+
+	for _, capture := range p.captures {
+		// Optional group that didn't participate in the match
+		if loc[2*capture.group] < 0 {
+			continue
+		}
+
+		var captured interface{} = text[loc[2*capture.group]:loc[2*capture.group+1]]
+
+		if len(capture.convert) > 0 {
+			converted, err := convertValue(captured, capture.convert)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("Unable to convert «%s» to %s: %v", capture.field, capture.convert, err)
+				}
+
+				continue
+			}
+
+			captured = converted
+		}
+
+		if err := msg.SetField("extra."+capture.field, captured); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return true, firstErr
+}
+
+// Tags message that wasn't parsed
+func (p *grokProcessor) fail(msg *storage.Message, err error) error {
+	if len(p.tag) > 0 {
+		msg.AddTag(p.tag)
+	}
+
+	return err
+}
+
+// Returns bundled patterns extended by «[grok_patterns]» section and patterns file of the processor
+func loadGrokPatterns(c *gc.Config, filename string) (map[string]string, error) {
+	onceGrok.Do(func() {
+		bundledPatterns = make(map[string]string)
+
+		if err := parseGrokPatterns(grokPatterns, bundledPatterns); err != nil {
+			panic(err)
+		}
+	})
+
+	patterns := make(map[string]string, len(bundledPatterns))
+	for name, expr := range bundledPatterns {
+		patterns[name] = expr
+	}
+
+	if c.HasSection("grok_patterns") {
+		names, _ := c.SectionOptions("grok_patterns")
+		for _, name := range names {
+			patterns[strings.ToUpper(name)] = config.Value(c, "grok_patterns", name)
+		}
+	}
+
+	if len(filename) > 0 {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read patterns file: %v", err)
+		}
+
+		if err = parseGrokPatterns(string(b), patterns); err != nil {
+			return nil, fmt.Errorf("patterns file %s: %v", filename, err)
+		}
+	}
+
+	return patterns, nil
+}
+
+// Parses patterns in the format of grok pattern files, lines starting with «#» are comments
+func parseGrokPatterns(text string, patterns map[string]string) error {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		definition := strings.TrimSpace(scanner.Text())
+		if len(definition) == 0 || strings.HasPrefix(definition, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(definition, " ", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[1])) == 0 {
+			return fmt.Errorf("line %d: pattern must be in format «NAME regexp»", line)
+		}
+
+		patterns[strings.ToUpper(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return scanner.Err()
+}
+
+// Replaces references to patterns with regular expressions. Returns expression and specs of named captures
+// in format «field» or «field:type» by generated group names
+func expandGrok(pattern string, patterns map[string]string) (string, map[string]string, error) {
+	named := make(map[string]string)
+
+	var expand func(expr string, depth int) (string, error)
+
+	expand = func(expr string, depth int) (string, error) {
+		if depth > maxGrokDepth {
+			return "", fmt.Errorf("patterns are nested too deep, probably recursive")
+		}
+
+		var firstErr error
+
+		result := reGrokReference.ReplaceAllStringFunc(expr, func(ref string) string {
+			m := reGrokReference.FindStringSubmatch(ref)
+
+			definition, ok := patterns[strings.ToUpper(m[1])]
+			if !ok {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("unknown pattern «%s»", m[1])
+				}
+
+				return ""
+			}
+
+			inner, err := expand(definition, depth+1)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+
+				return ""
+			}
+
+			if len(m[2]) == 0 {
+				return "(?:" + inner + ")"
+			}
+
+			group := "g" + strconv.Itoa(len(named))
+			named[group] = m[2]
+			if len(m[3]) > 0 {
+				named[group] += ":" + m[3]
+			}
+
+			return "(?P<" + group + ">" + inner + ")"
+		})
+
+		return result, firstErr
+	}
+
+	expr, err := expand(pattern, 0)
+
+	return expr, named, err
+}
+
+// Parses list of conversions like «bytes:int, duration:float»
+func parseTypes(value string) (map[string]string, error) {
+	types := make(map[string]string)
+
+	for _, item := range config.SplitList(value) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("type «%s» must be in format «field:type»", item)
+		}
+
+		switch convert := strings.TrimSpace(parts[1]); convert {
+		case "int", "float", "string", "bool":
+			types[strings.TrimSpace(parts[0])] = convert
+		default:
+			return nil, fmt.Errorf("unknown type «%s», use int, float, string or bool", convert)
+		}
+	}
+
+	return types, nil
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestExpandGrok(t *testing.T) {
+	patterns := map[string]string{
+		"INT":  `[+-]?\d+`,
+		"WORD": `\w+`,
+		"PAIR": `%{WORD:key}=%{WORD:value}`,
+	}
+
+	tests := []struct {
+		pattern  string
+		text     string
+		expected map[string]string
+	}{
+		{"%{INT:bytes:int} bytes", "512 bytes", map[string]string{"bytes:int": "512"}},
+		{"%{int:bytes}", "-7", map[string]string{"bytes": "-7"}},
+		{"%{WORD} %{INT:code}", "GET 200", map[string]string{"code": "200"}},
+		{"%{PAIR}", "user=bob", map[string]string{"key": "user", "value": "bob"}},
+		{"%{WORD:method} %{PAIR}", "GET id=42", map[string]string{"method": "GET", "key": "id", "value": "42"}},
+		{"no references", "no references", map[string]string{}},
+	}
+
+	for _, test := range tests {
+		expr, named, err := expandGrok(test.pattern, patterns)
+		if err != nil {
+			t.Errorf("expandGrok(%q) returned error: %v", test.pattern, err)
+
+			continue
+		}
+
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			t.Errorf("expandGrok(%q) returned invalid expression %q: %v", test.pattern, expr, err)
+
+			continue
+		}
+
+		m := re.FindStringSubmatch(test.text)
+		if m == nil {
+			t.Errorf("expression %q of %q doesn't match %q", expr, test.pattern, test.text)
+
+			continue
+		}
+
+		actual := make(map[string]string)
+		for i, group := range re.SubexpNames() {
+			if len(group) > 0 {
+				actual[named[group]] = m[i]
+			}
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Errorf("expandGrok(%q) captured %v, expected %v", test.pattern, actual, test.expected)
+
+			continue
+		}
+
+		for spec, value := range test.expected {
+			if actual[spec] != value {
+				t.Errorf("expandGrok(%q) captured %v, expected %v", test.pattern, actual, test.expected)
+
+				break
+			}
+		}
+	}
+}
+
+func TestExpandGrokErrors(t *testing.T) {
+	patterns := map[string]string{
+		"LOOP": `a%{POOL}`,
+		"POOL": `b%{LOOP}`,
+		"SELF": `%{SELF}`,
+	}
+
+	for _, pattern := range []string{"%{MISSING}", "%{LOOP}", "x %{SELF:field}"} {
+		if _, _, err := expandGrok(pattern, patterns); err == nil {
+			t.Errorf("expandGrok(%q) didn't return error", pattern)
+		}
+	}
+}
+
+func TestParseGrokPatterns(t *testing.T) {
+	patterns := make(map[string]string)
+
+	err := parseGrokPatterns("# comment\n\nint [+-]?\\d+\nWORD  \\w+ \n", patterns)
+	if err != nil {
+		t.Fatalf("parseGrokPatterns returned error: %v", err)
+	}
+
+	if patterns["INT"] != `[+-]?\d+` || patterns["WORD"] != `\w+` || len(patterns) != 2 {
+		t.Errorf("parseGrokPatterns returned %v", patterns)
+	}
+
+	if err = parseGrokPatterns("NAME", patterns); err == nil {
+		t.Errorf("parseGrokPatterns didn't return error for pattern without expression")
+	}
+}
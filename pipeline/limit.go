@@ -0,0 +1,400 @@
+package pipeline
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+const (
+	defaultLimitMaxKeys     int           = 10000
+	defaultSummaryInterval  time.Duration = time.Minute
+	maxSummaryKeys          int           = 10
+	overflowKey             string        = "\xffoverflow"
+	summaryFacility         string        = "recause"
+	summaryLevel            int32         = 5
+	sampleRateField         string        = "extra.sample_rate"
+	defaultSampleHashFields string        = "short_message"
+	// Maximum number of keys counted per tenant between summaries, other keys are counted together
+	maxSummaryCounters int = 1000
+	// Idle buckets are looked for not more often, so flood of unique keys doesn't scan all buckets per message
+	limitEvictInterval time.Duration = time.Second
+)
+
+// Processor that periodically reports what it dropped
+type summarizer interface {
+	summaries(now time.Time) []*storage.Message
+}
+
+// Counts dropped messages by tenant and key and returns synthetic summary messages
+type dropSummary struct {
+	name     string
+	action   string
+	interval time.Duration
+	counts   map[string]map[string]int64
+	last     time.Time
+	mutex    *sync.Mutex
+}
+
+func newDropSummary(c *gc.Config, name, section, action string) (*dropSummary, error) {
+	s := &dropSummary{
+		name:     name,
+		action:   action,
+		interval: defaultSummaryInterval,
+		counts:   make(map[string]map[string]int64),
+		last:     time.Now(),
+		mutex:    &sync.Mutex{},
+	}
+
+	switch value := config.Value(c, section, "summary_interval"); value {
+	case "":
+	case "off":
+		s.interval = 0
+	default:
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("option «summary_interval» must be a positive duration or «off»")
+		}
+
+		s.interval = d
+	}
+
+	return s, nil
+}
+
+func (s *dropSummary) record(msg *storage.Message, key string) {
+	// Nobody reads counts when summaries are disabled
+	if s.interval == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byKey, ok := s.counts[msg.Tenant]
+	if !ok {
+		byKey = make(map[string]int64)
+		s.counts[msg.Tenant] = byKey
+	}
+
+	if _, ok = byKey[key]; !ok && len(byKey) >= maxSummaryCounters {
+		key = overflowKey
+	}
+
+	byKey[key]++
+}
+
+// Returns summary message per tenant once in the interval, tenants without dropped messages get nothing
+func (s *dropSummary) summaries(now time.Time) []*storage.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.interval == 0 || now.Sub(s.last) < s.interval {
+		return nil
+	}
+
+	var (
+		result []*storage.Message
+		host   string
+	)
+
+	host, _ = os.Hostname()
+
+	for tenant, byKey := range s.counts {
+		var (
+			keys  []string
+			total int64
+		)
+
+		for key, count := range byKey {
+			keys = append(keys, key)
+			total += count
+		}
+
+		// Keys that lost the most messages go first
+		sort.Slice(keys, func(i, j int) bool {
+			if byKey[keys[i]] != byKey[keys[j]] {
+				return byKey[keys[i]] > byKey[keys[j]]
+			}
+
+			return keys[i] < keys[j]
+		})
+
+		top := []string{}
+		for i, key := range keys {
+			if i == maxSummaryKeys {
+				break
+			}
+
+			// Values of several key fields are shown separated by slashes
+			label := strings.Replace(key, "\xff", "/", -1)
+			if key == overflowKey {
+				label = "other"
+			}
+
+			top = append(top, fmt.Sprintf("%s=%d", label, byKey[key]))
+		}
+
+		result = append(result, &storage.Message{
+			Version:      "1.1",
+			Host:         host,
+			ShortMessage: fmt.Sprintf("Processor «%s» %s %d messages in the last %s", s.name, s.action, total, now.Sub(s.last)/time.Second*time.Second),
+			Timestamp:    now,
+			Level:        summaryLevel,
+			Facility:     summaryFacility,
+			Tenant:       tenant,
+			Extra: map[string]interface{}{
+				"_processor": s.name,
+				"_dropped":   total,
+				"_top_keys":  strings.Join(top, ", "),
+			},
+		})
+	}
+
+	s.counts = make(map[string]map[string]int64)
+	s.last = now
+
+	return result
+}
+
+// Drops messages of keys that exceed the rate, every key has its own token bucket
+type rateLimitProcessor struct {
+	*dropSummary
+	key     []string
+	rate    float64
+	burst   float64
+	maxKeys int
+	buckets map[string]*tokenBucket
+	// Time idle buckets were looked for last time
+	evicted time.Time
+	mutex   *sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimitProcessor(c *gc.Config, name, section string) (Processor, error) {
+	summary, err := newDropSummary(c, name, section, "rate limited")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &rateLimitProcessor{
+		dropSummary: summary,
+		key:         config.SplitList(config.Value(c, section, "key")),
+		maxKeys:     defaultLimitMaxKeys,
+		buckets:     make(map[string]*tokenBucket),
+		mutex:       &sync.Mutex{},
+	}
+
+	if len(p.key) == 0 {
+		p.key = []string{"host"}
+	}
+
+	if p.rate, err = strconv.ParseFloat(config.Value(c, section, "rate"), 64); err != nil || p.rate <= 0 {
+		return nil, fmt.Errorf("option «rate» must be a positive number of messages per second")
+	}
+
+	p.burst = math.Max(p.rate, 1)
+
+	if value := config.Value(c, section, "burst"); len(value) > 0 {
+		if p.burst, err = strconv.ParseFloat(value, 64); err != nil || p.burst < 1 {
+			return nil, fmt.Errorf("option «burst» must be a number not less than 1")
+		}
+	}
+
+	if value := config.Value(c, section, "max_keys"); len(value) > 0 {
+		if p.maxKeys, err = strconv.Atoi(value); err != nil || p.maxKeys <= 0 {
+			return nil, fmt.Errorf("option «max_keys» must be a positive integer")
+		}
+	}
+
+	return p, nil
+}
+
+func (p *rateLimitProcessor) Process(msg *storage.Message) (bool, error) {
+	key := fieldsKey(msg, p.key)
+
+	if p.allow(key, time.Now()) {
+		return true, nil
+	}
+
+	p.record(msg, key)
+
+	return false, nil
+}
+
+// Takes token from the bucket of the key
+func (p *rateLimitProcessor) allow(key string, now time.Time) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	bucket, ok := p.buckets[key]
+	if !ok {
+		if len(p.buckets) >= p.maxKeys && now.Sub(p.evicted) >= limitEvictInterval {
+			p.evictIdle(now)
+		}
+
+		// Keys above the limit share one bucket, so memory stays bounded
+		if len(p.buckets) >= p.maxKeys {
+			key = overflowKey
+		}
+
+		if bucket, ok = p.buckets[key]; !ok {
+			bucket = &tokenBucket{tokens: p.burst, updated: now}
+			p.buckets[key] = bucket
+		}
+	}
+
+	bucket.tokens = math.Min(p.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*p.rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+
+	return true
+}
+
+// Removes buckets that are full again, they behave exactly like new ones
+func (p *rateLimitProcessor) evictIdle(now time.Time) {
+	p.evicted = now
+
+	for key, bucket := range p.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*p.rate >= p.burst {
+			delete(p.buckets, key)
+		}
+	}
+}
+
+// Keeps part of messages depending on their level and stores sampling rate in kept messages
+type sampleProcessor struct {
+	*dropSummary
+	// Fraction of kept messages by level, levels that are not listed are kept
+	rates map[int32]float64
+	// Fields which hash decides if message is kept, nil means random decision
+	hashFields []string
+}
+
+func newSampleProcessor(c *gc.Config, name, section string) (Processor, error) {
+	summary, err := newDropSummary(c, name, section, "sampled out")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &sampleProcessor{dropSummary: summary}
+
+	if p.rates, err = parseSampleRates(config.Value(c, section, "rates")); err != nil {
+		return nil, err
+	}
+
+	switch mode := config.Value(c, section, "mode"); mode {
+	case "", "random":
+	case "hash":
+		p.hashFields = config.SplitList(config.Value(c, section, "fields"))
+		if len(p.hashFields) == 0 {
+			p.hashFields = []string{defaultSampleHashFields}
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode «%s», use random or hash", mode)
+	}
+
+	return p, nil
+}
+
+// Parses rates like «debug:0.01, info:0.1», levels are syslog names or numbers
+func parseSampleRates(value string) (map[int32]float64, error) {
+	rates := make(map[int32]float64)
+
+	for _, item := range config.SplitList(value) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("rate «%s» must be in format «level:fraction»", item)
+		}
+
+		level, err := storage.ParseLevel(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("unknown level «%s»", strings.TrimSpace(parts[0]))
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("rate of level «%s» must be a fraction in (0, 1]", parts[0])
+		}
+
+		rates[level] = rate
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("option «rates» is required")
+	}
+
+	return rates, nil
+}
+
+func (p *sampleProcessor) Process(msg *storage.Message) (bool, error) {
+	rate, ok := p.rates[msg.Level]
+	if !ok || rate >= 1 {
+		return true, nil
+	}
+
+	var point float64
+
+	if p.hashFields == nil {
+		point = rand.Float64()
+	} else {
+		// The same values get the same decision, e.g. all messages of a request are kept or dropped together
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(fieldsKey(msg, p.hashFields)))
+		point = float64(mix64(h.Sum64())>>11) / (1 << 53)
+	}
+
+	if point >= rate {
+		p.record(msg, strconv.Itoa(int(msg.Level)))
+
+		return false, nil
+	}
+
+	// Every kept message stands for 1/rate messages, so counts can be re-weighted
+	return true, msg.SetField(sampleRateField, 1/rate)
+}
+
+// Spreads bits of the hash, high bits of FNV hashes of short similar strings are almost the same
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
+
+// Returns values of fields joined into a single key
+func fieldsKey(msg *storage.Message, fields []string) string {
+	parts := make([]string, len(fields))
+
+	for i, field := range fields {
+		if value, ok := msg.Field(field); ok {
+			parts[i] = fmt.Sprint(value)
+		}
+	}
+
+	return strings.Join(parts, "\xff")
+}
@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitAllow(t *testing.T) {
+	p := &rateLimitProcessor{
+		rate:    1,
+		burst:   2,
+		maxKeys: 2,
+		buckets: make(map[string]*tokenBucket),
+		mutex:   &sync.Mutex{},
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		key      string
+		offset   time.Duration
+		expected bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		{"b", 0, true},
+		{"a", 500 * time.Millisecond, false},
+		{"a", time.Second, true},
+		{"a", time.Second, false},
+		// Full bucket of «b» is evicted to make room for «c»
+		{"c", time.Second, true},
+		// Keys above the limit share one bucket
+		{"d", time.Second, true},
+		{"e", time.Second, true},
+		{"f", time.Second, false},
+		{"a", 10 * time.Second, true},
+	}
+
+	for i, test := range tests {
+		if actual := p.allow(test.key, now.Add(test.offset)); actual != test.expected {
+			t.Errorf("test %d: allow(%q) = %v, expected %v", i, test.key, actual, test.expected)
+		}
+	}
+
+	if _, ok := p.buckets[overflowKey]; !ok || len(p.buckets) > p.maxKeys+1 {
+		t.Errorf("buckets of keys above the limit aren't shared: %v", p.buckets)
+	}
+}
+
+func TestParseSampleRates(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected map[int32]float64
+	}{
+		{"debug:0.01, info:0.1", map[int32]float64{7: 0.01, 6: 0.1}},
+		{"7:1", map[int32]float64{7: 1}},
+		{"", nil},
+		{"debug", nil},
+		{"verbose:0.5", nil},
+		{"debug:0", nil},
+		{"debug:1.5", nil},
+		{"debug:half", nil},
+	}
+
+	for _, test := range tests {
+		actual, err := parseSampleRates(test.value)
+
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("parseSampleRates(%q) didn't return error", test.value)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseSampleRates(%q) returned error: %v", test.value, err)
+		} else if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("parseSampleRates(%q) = %v, expected %v", test.value, actual, test.expected)
+		}
+	}
+}
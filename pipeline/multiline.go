@@ -0,0 +1,236 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/match"
+)
+
+const (
+	defaultMultilineTimeout  time.Duration = 2 * time.Second
+	defaultMultilineMaxLines int           = 500
+)
+
+// Merges messages that are lines of one event, e.g. stack trace sent line by line, into a single message.
+// Lines are grouped by key fields, group is emitted when the next event starts, when it has too many lines
+// or when no lines arrive during the timeout
+type Multiline struct {
+	// Settings are nil when reassembly is not configured
+	settings *multilineSettings
+	groups   map[string]*multilineGroup
+	mutex    *sync.Mutex
+}
+
+type multilineSettings struct {
+	// Only matching messages are merged, nil means all messages
+	condition *match.Matcher
+	// Line that starts new event, other lines are continuations
+	start *regexp.Regexp
+	// Line that continues previous event
+	continuation *regexp.Regexp
+	key          []string
+	timeout      time.Duration
+	maxLines     int
+}
+
+// Lines of the event received so far
+type multilineGroup struct {
+	msg     *storage.Message
+	lines   []string
+	updated time.Time
+}
+
+// Returns aggregator described in «[multiline]» section
+func NewMultiline(c *gc.Config) (*Multiline, error) {
+	settings, err := readMultilineSettings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Multiline{
+		settings: settings,
+		groups:   make(map[string]*multilineGroup),
+		mutex:    &sync.Mutex{},
+	}, nil
+}
+
+// Reads settings of the aggregator, returns nil if neither «start» nor «continuation» is set
+func readMultilineSettings(c *gc.Config) (*multilineSettings, error) {
+	var (
+		s   *multilineSettings = &multilineSettings{timeout: defaultMultilineTimeout, maxLines: defaultMultilineMaxLines}
+		err error
+	)
+
+	for name, target := range map[string]**regexp.Regexp{"start": &s.start, "continuation": &s.continuation} {
+		if value := config.Value(c, "multiline", name); len(value) > 0 {
+			if *target, err = regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("invalid «%s» pattern: %v", name, err)
+			}
+		}
+	}
+
+	if s.start == nil && s.continuation == nil {
+		return nil, nil
+	}
+
+	if condition := config.Value(c, "multiline", "if"); len(condition) > 0 {
+		if s.condition, err = match.Compile(condition); err != nil {
+			return nil, fmt.Errorf("invalid condition: %v", err)
+		}
+	}
+
+	s.key = config.SplitList(config.Value(c, "multiline", "key"))
+	if len(s.key) == 0 {
+		s.key = []string{"host", "facility"}
+	}
+
+	if value := config.Value(c, "multiline", "timeout"); len(value) > 0 {
+		if s.timeout, err = time.ParseDuration(value); err != nil || s.timeout <= 0 {
+			return nil, fmt.Errorf("option «timeout» must be a positive duration")
+		}
+	}
+
+	if value := config.Value(c, "multiline", "max_lines"); len(value) > 0 {
+		if s.maxLines, err = strconv.Atoi(value); err != nil || s.maxLines < 2 {
+			return nil, fmt.Errorf("option «max_lines» must be an integer greater than 1")
+		}
+	}
+
+	return s, nil
+}
+
+// Adds message to its group. Returns messages that are complete and must be stored
+func (m *Multiline) Add(msg *storage.Message) []*storage.Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := m.settings
+	if s == nil || (s.condition != nil && !s.condition.Match(msg)) {
+		return []*storage.Message{msg}
+	}
+
+	var (
+		ready []*storage.Message
+		key   string = s.groupKey(msg)
+	)
+
+	if group, ok := m.groups[key]; ok {
+		if s.isContinuation(msg.ShortMessage) {
+			group.add(msg)
+
+			if len(group.lines) >= s.maxLines {
+				delete(m.groups, key)
+				ready = append(ready, group.merge())
+			}
+
+			return ready
+		}
+
+		delete(m.groups, key)
+		ready = append(ready, group.merge())
+	}
+
+	// Continuation without the first line starts the group too, so the rest of the event stays together
+	group := &multilineGroup{msg: msg}
+	group.add(msg)
+	m.groups[key] = group
+
+	return ready
+}
+
+// Returns groups that didn't get new lines during the timeout
+func (m *Multiline) Expire(now time.Time) []*storage.Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var ready []*storage.Message
+
+	for key, group := range m.groups {
+		// Groups left after reassembly was disabled by reload are emitted at once
+		if m.settings == nil || now.Sub(group.updated) >= m.settings.timeout {
+			delete(m.groups, key)
+			ready = append(ready, group.merge())
+		}
+	}
+
+	return ready
+}
+
+// Returns all incomplete groups, used on shutdown
+func (m *Multiline) Flush() []*storage.Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var ready []*storage.Message
+
+	for key, group := range m.groups {
+		delete(m.groups, key)
+		ready = append(ready, group.merge())
+	}
+
+	return ready
+}
+
+// Reads settings from the new config, groups collected so far are kept
+func (m *Multiline) PrepareReload(c *gc.Config) (func(), error) {
+	settings, err := readMultilineSettings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		m.settings = settings
+	}, nil
+}
+
+// Returns key of the group, messages of different tenants are never merged
+func (s *multilineSettings) groupKey(msg *storage.Message) string {
+	parts := []string{msg.Tenant}
+
+	for _, field := range s.key {
+		value, _ := msg.Field(field)
+		parts = append(parts, fmt.Sprint(value))
+	}
+
+	return strings.Join(parts, "\xff")
+}
+
+func (s *multilineSettings) isContinuation(line string) bool {
+	if s.continuation != nil && s.continuation.MatchString(line) {
+		return true
+	}
+
+	return s.start != nil && !s.start.MatchString(line)
+}
+
+func (g *multilineGroup) add(msg *storage.Message) {
+	line := msg.FullMessage
+	if len(line) == 0 {
+		line = msg.ShortMessage
+	}
+
+	g.lines = append(g.lines, line)
+	g.updated = time.Now()
+}
+
+// Returns the first message with all lines in full message
+func (g *multilineGroup) merge() *storage.Message {
+	if len(g.lines) > 1 {
+		g.msg.FullMessage = strings.Join(g.lines, "\n")
+		g.msg.AddTag("multiline")
+	}
+
+	return g.msg
+}
@@ -0,0 +1,338 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+const (
+	defaultMaxDepth int = 3
+	defaultMaxKeys  int = 100
+)
+
+// Settings shared by processors that parse structured payloads of text fields
+type payloadParser struct {
+	field string
+	// Prefix of extra fields created from keys of the payload
+	prefix   string
+	maxDepth int
+	maxKeys  int
+	// Key of the payload which value replaces parsed field, empty means that field is kept as is
+	messageField string
+	tag          string
+}
+
+func newPayloadParser(c *gc.Config, section, kind string) (*payloadParser, error) {
+	p := &payloadParser{
+		field:        config.Value(c, section, "field"),
+		prefix:       config.Value(c, section, "prefix"),
+		maxDepth:     defaultMaxDepth,
+		maxKeys:      defaultMaxKeys,
+		messageField: config.Value(c, section, "message_field"),
+		tag:          config.Value(c, section, "tag_on_failure"),
+	}
+
+	if len(p.field) == 0 {
+		p.field = "short_message"
+	}
+
+	switch p.tag {
+	case "":
+		p.tag = kind + "_failure"
+	case "none":
+		p.tag = ""
+	}
+
+	for name, target := range map[string]*int{"max_depth": &p.maxDepth, "max_keys": &p.maxKeys} {
+		if value := config.Value(c, section, name); len(value) > 0 {
+			i, err := strconv.Atoi(value)
+			if err != nil || i <= 0 {
+				return nil, fmt.Errorf("option «%s» must be a positive integer", name)
+			}
+
+			*target = i
+		}
+	}
+
+	return p, nil
+}
+
+// Returns text of the parsed field, false if field is missing or isn't a string
+func (p *payloadParser) text(msg *storage.Message) (string, bool) {
+	value, ok := msg.Field(p.field)
+	if !ok {
+		return "", false
+	}
+
+	s, ok := value.(string)
+
+	return strings.TrimSpace(s), ok
+}
+
+// Writes keys of the payload to extra fields, nested objects are flattened with dots
+func (p *payloadParser) write(msg *storage.Message, payload map[string]interface{}) error {
+	var (
+		written int
+		err     error
+	)
+
+	if len(p.messageField) > 0 {
+		if body, ok := payload[p.messageField]; ok && body != nil {
+			if err = msg.SetField(p.field, fmt.Sprint(body)); err != nil {
+				return err
+			}
+
+			delete(payload, p.messageField)
+		}
+	}
+
+	var flatten func(prefix string, object map[string]interface{}, depth int) error
+
+	flatten = func(prefix string, object map[string]interface{}, depth int) error {
+		// Keys are sorted, so the same keys are dropped when payload has too many of them
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := object[key]
+			name := prefix + key
+
+			if value == nil {
+				continue
+			}
+
+			if nested, ok := value.(map[string]interface{}); ok {
+				if depth < p.maxDepth {
+					if err := flatten(name+".", nested, depth+1); err != nil {
+						return err
+					}
+
+					continue
+				}
+
+				// Objects deeper than the limit are stored as JSON strings
+				b, _ := json.Marshal(nested)
+				value = string(b)
+			}
+
+			if list, ok := value.([]interface{}); ok && !isScalarList(list) {
+				b, _ := json.Marshal(list)
+				value = string(b)
+			}
+
+			if written >= p.maxKeys {
+				return fmt.Errorf("Payload has more than %d keys, the rest are skipped", p.maxKeys)
+			}
+
+			if err := msg.SetField("extra."+name, value); err != nil {
+				return err
+			}
+
+			written++
+		}
+
+		return nil
+	}
+
+	return flatten(p.prefix, payload, 1)
+}
+
+// Tags message that wasn't parsed
+func (p *payloadParser) fail(msg *storage.Message, err error) error {
+	if len(p.tag) > 0 {
+		msg.AddTag(p.tag)
+	}
+
+	return err
+}
+
+// Checks if list contains only strings, numbers or booleans, storage can't index lists of mixed objects
+func isScalarList(list []interface{}) bool {
+	for _, item := range list {
+		switch item.(type) {
+		case string, float64, int64, bool:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Parses JSON objects logged as text
+type jsonProcessor struct {
+	*payloadParser
+}
+
+func newJsonProcessor(c *gc.Config, section string) (Processor, error) {
+	parser, err := newPayloadParser(c, section, "json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonProcessor{parser}, nil
+}
+
+func (p *jsonProcessor) Process(msg *storage.Message) (bool, error) {
+	text, ok := p.text(msg)
+
+	// Text that doesn't look like JSON object isn't an error
+	if !ok || !strings.HasPrefix(text, "{") {
+		return true, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	var payload map[string]interface{}
+
+	if err := decoder.Decode(&payload); err != nil {
+		return true, p.fail(msg, fmt.Errorf("Unable to parse JSON: %v", err))
+	}
+
+	return true, p.write(msg, normalizeNumbers(payload).(map[string]interface{}))
+}
+
+// Converts JSON numbers to int64 when possible, so large identifiers don't lose precision
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	}
+
+	return value
+}
+
+// Parses «key=value» pairs, values with spaces are quoted
+type logfmtProcessor struct {
+	*payloadParser
+}
+
+func newLogfmtProcessor(c *gc.Config, section string) (Processor, error) {
+	parser, err := newPayloadParser(c, section, "logfmt")
+	if err != nil {
+		return nil, err
+	}
+
+	return &logfmtProcessor{parser}, nil
+}
+
+func (p *logfmtProcessor) Process(msg *storage.Message) (bool, error) {
+	text, ok := p.text(msg)
+	if !ok || !strings.Contains(text, "=") {
+		return true, nil
+	}
+
+	payload, err := parseLogfmt(text)
+	if err != nil {
+		return true, p.fail(msg, err)
+	}
+
+	// Prose with occasional «=» isn't logfmt
+	if payload == nil {
+		return true, nil
+	}
+
+	return true, p.write(msg, payload)
+}
+
+// Parses logfmt line. Returns nil if text contains words that are not pairs, error if pairs are malformed
+func parseLogfmt(text string) (map[string]interface{}, error) {
+	var (
+		payload map[string]interface{} = make(map[string]interface{})
+		i       int
+	)
+
+	for i < len(text) {
+		for i < len(text) && unicode.IsSpace(rune(text[i])) {
+			i++
+		}
+
+		if i >= len(text) {
+			break
+		}
+
+		start := i
+		for i < len(text) && text[i] != '=' && !unicode.IsSpace(rune(text[i])) && text[i] != '"' {
+			i++
+		}
+
+		if i == start || i >= len(text) || text[i] != '=' {
+			return nil, nil
+		}
+
+		key := text[start:i]
+		i++
+
+		var value bytes.Buffer
+
+		if i < len(text) && text[i] == '"' {
+			i++
+
+			closed := false
+			for i < len(text) {
+				if text[i] == '\\' && i+1 < len(text) {
+					value.WriteByte(text[i+1])
+					i += 2
+
+					continue
+				}
+
+				if text[i] == '"' {
+					closed = true
+					i++
+
+					break
+				}
+
+				value.WriteByte(text[i])
+				i++
+			}
+
+			if !closed {
+				return nil, fmt.Errorf("Value of key «%s» is not terminated", key)
+			}
+		} else {
+			for i < len(text) && !unicode.IsSpace(rune(text[i])) {
+				value.WriteByte(text[i])
+				i++
+			}
+		}
+
+		payload[key] = value.String()
+	}
+
+	if len(payload) == 0 {
+		return nil, nil
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/endeveit/recause/storage"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected map[string]interface{}
+		err      bool
+	}{
+		{"level=info msg=started", map[string]interface{}{"level": "info", "msg": "started"}, false},
+		{`msg="connection refused" retry=3`, map[string]interface{}{"msg": "connection refused", "retry": "3"}, false},
+		{`msg="say \"hi\"" path="C:\\tmp"`, map[string]interface{}{"msg": `say "hi"`, "path": `C:\tmp`}, false},
+		{"  a=1\tb=  ", map[string]interface{}{"a": "1", "b": ""}, false},
+		{"empty=", map[string]interface{}{"empty": ""}, false},
+		{`empty=""`, map[string]interface{}{"empty": ""}, false},
+		{"url=http://host/?a=b", map[string]interface{}{"url": "http://host/?a=b"}, false},
+		{"", nil, false},
+		{"   ", nil, false},
+		{"plain text message", nil, false},
+		{"level=info and then words", nil, false},
+		{"=value", nil, false},
+		{`key"=value`, nil, false},
+		{`msg="not terminated`, nil, true},
+	}
+
+	for _, test := range tests {
+		actual, err := parseLogfmt(test.text)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("parseLogfmt(%q) didn't return error", test.text)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseLogfmt(%q) returned error: %v", test.text, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("parseLogfmt(%q) = %v, expected %v", test.text, actual, test.expected)
+		}
+	}
+}
+
+func TestPayloadParserWrite(t *testing.T) {
+	payload := func() map[string]interface{} {
+		return map[string]interface{}{
+			"msg":  "request done",
+			"code": 200,
+			"skip": nil,
+			"http": map[string]interface{}{
+				"method": "GET",
+				"headers": map[string]interface{}{
+					"host": "example.com",
+				},
+			},
+			"tags":  []interface{}{"a", "b"},
+			"items": []interface{}{map[string]interface{}{"id": 1}},
+		}
+	}
+
+	tests := []struct {
+		parser   *payloadParser
+		expected map[string]interface{}
+		short    string
+		err      bool
+	}{
+		{
+			parser: &payloadParser{field: "short_message", maxDepth: 3, maxKeys: 100},
+			expected: map[string]interface{}{
+				"code":              200,
+				"http.method":       "GET",
+				"http.headers.host": "example.com",
+				"msg":               "request done",
+				"tags":              []interface{}{"a", "b"},
+				"items":             `[{"id":1}]`,
+			},
+			short: "original",
+		},
+		{
+			parser: &payloadParser{field: "short_message", prefix: "app.", maxDepth: 2, maxKeys: 100, messageField: "msg"},
+			expected: map[string]interface{}{
+				"app.code":         200,
+				"app.http.method":  "GET",
+				"app.http.headers": `{"host":"example.com"}`,
+				"app.tags":         []interface{}{"a", "b"},
+				"app.items":        `[{"id":1}]`,
+			},
+			short: "request done",
+		},
+		{
+			parser: &payloadParser{field: "short_message", maxDepth: 1, maxKeys: 2},
+			expected: map[string]interface{}{
+				"code": 200,
+				"http": `{"headers":{"host":"example.com"},"method":"GET"}`,
+			},
+			short: "original",
+			err:   true,
+		},
+	}
+
+	for i, test := range tests {
+		msg := &storage.Message{ShortMessage: "original", Extra: map[string]interface{}{}}
+
+		err := test.parser.write(msg, payload())
+		if test.err != (err != nil) {
+			t.Errorf("test %d: write returned error %v", i, err)
+		}
+
+		// Extra fields are stored with «_» prefix required by GELF
+		expected := make(map[string]interface{})
+		for key, value := range test.expected {
+			expected["_"+key] = value
+		}
+
+		if !reflect.DeepEqual(msg.Extra, expected) {
+			t.Errorf("test %d: extra fields are %v, expected %v", i, msg.Extra, expected)
+		}
+
+		if msg.ShortMessage != test.short {
+			t.Errorf("test %d: short message is %q, expected %q", i, msg.ShortMessage, test.short)
+		}
+	}
+}
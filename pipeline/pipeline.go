@@ -0,0 +1,290 @@
+// Package pipeline contains processors that modify or drop messages between receivers and storage.
+// Processors are described in «processor:<name>» sections and applied in order listed in «[pipeline] processors»
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
+	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/match"
+)
+
+// Processor modifies message in place, false means that message must be dropped
+type Processor interface {
+	Process(msg *storage.Message) (bool, error)
+}
+
+// Ordered list of processors
+type Pipeline struct {
+	stages []*stage
+	mutex  *sync.RWMutex
+}
+
+type stage struct {
+	name      string
+	processor Processor
+	// Processor is applied only to messages matching the condition, nil means all messages
+	condition   *match.Matcher
+	dropOnError bool
+}
+
+// Returns pipeline described in the config
+func New(c *gc.Config) (*Pipeline, error) {
+	stages, err := readStages(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{stages: stages, mutex: &sync.RWMutex{}}, nil
+}
+
+// Reads processors listed in «[pipeline] processors»
+func readStages(c *gc.Config) ([]*stage, error) {
+	var (
+		stages []*stage
+		seen   map[string]bool = make(map[string]bool)
+	)
+
+	for _, name := range config.SplitList(config.Value(c, "pipeline", "processors")) {
+		if seen[name] {
+			return nil, fmt.Errorf("Processor «%s» is listed twice", name)
+		}
+
+		seen[name] = true
+
+		section := "processor:" + name
+		if !c.HasSection(section) {
+			return nil, fmt.Errorf("Section [%s] is missing", section)
+		}
+
+		s, err := newStage(c, name, section)
+		if err != nil {
+			return nil, fmt.Errorf("Processor «%s»: %v", name, err)
+		}
+
+		stages = append(stages, s)
+	}
+
+	return stages, nil
+}
+
+func newStage(c *gc.Config, name, section string) (*stage, error) {
+	s := &stage{name: name}
+
+	if condition := config.Value(c, section, "if"); len(condition) > 0 {
+		matcher, err := match.Compile(condition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition: %v", err)
+		}
+
+		s.condition = matcher
+	}
+
+	switch onError := config.Value(c, section, "on_error"); onError {
+	case "", "continue":
+	case "drop":
+		s.dropOnError = true
+	default:
+		return nil, fmt.Errorf("unknown «on_error» value «%s»", onError)
+	}
+
+	var err error
+
+	switch kind := config.Value(c, section, "type"); kind {
+	case "set":
+		s.processor, err = newSetProcessor(c, section)
+	case "rename":
+		s.processor, err = newRenameProcessor(c, section, true)
+	case "copy":
+		s.processor, err = newRenameProcessor(c, section, false)
+	case "remove":
+		s.processor, err = newRemoveProcessor(c, section)
+	case "lowercase":
+		s.processor, err = newLowercaseProcessor(c, section)
+	case "convert":
+		s.processor, err = newConvertProcessor(c, section)
+	case "level":
+		s.processor, err = newLevelProcessor(c, section)
+	case "grok", "regex":
+		s.processor, err = newGrokProcessor(c, section, kind)
+	case "json":
+		s.processor, err = newJsonProcessor(c, section)
+	case "logfmt":
+		s.processor, err = newLogfmtProcessor(c, section)
+	case "geoip":
+		s.processor, err = newGeoipProcessor(c, section)
+	case "redact":
+		s.processor, err = newRedactProcessor(c, name, section)
+	case "ratelimit":
+		s.processor, err = newRateLimitProcessor(c, name, section)
+	case "sample":
+		s.processor, err = newSampleProcessor(c, name, section)
+	case "dedup":
+		s.processor, err = newDedupProcessor(c, section)
+	case "drop":
+		// Dropping every message is almost certainly a mistake
+		if s.condition == nil {
+			return nil, fmt.Errorf("option «if» is required")
+		}
+
+		s.processor = dropProcessor{}
+	case "":
+		return nil, fmt.Errorf("option «type» is required")
+	default:
+		return nil, fmt.Errorf("unknown type «%s»", kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Passes message through all processors, returns false if message was dropped
+func (p *Pipeline) Process(msg *storage.Message) bool {
+	for _, s := range p.getStages() {
+		if s.condition != nil && !s.condition.Match(msg) {
+			continue
+		}
+
+		keep, err := s.processor.Process(msg)
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("processor", s.name).
+				Debug("Unable to process message")
+
+			metrics.ProcessorErrors.With(s.name).Inc()
+
+			keep = keep && !s.dropOnError
+		}
+
+		if !keep {
+			metrics.ProcessorDropped.With(s.name).Inc()
+			metrics.MessagesDropped.With("pipeline", "processor").Inc()
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns summaries of messages dropped by rate limits and sampling and collapsed repeats that are due by now
+func (p *Pipeline) Summaries(now time.Time) []*storage.Message {
+	var result []*storage.Message
+
+	for _, s := range p.getStages() {
+		if summarizer, ok := s.processor.(summarizer); ok {
+			result = append(result, summarizer.summaries(now)...)
+		}
+	}
+
+	return result
+}
+
+// Returns number of processors in the pipeline
+func (p *Pipeline) Len() int {
+	return len(p.getStages())
+}
+
+// Reads processors from the new config, returned function replaces them
+func (p *Pipeline) PrepareReload(c *gc.Config) (func(), error) {
+	stages, err := readStages(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		p.stages = stages
+	}, nil
+}
+
+func (p *Pipeline) getStages() []*stage {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.stages
+}
+
+// Interval of checking multiline groups for timeout
+const multilineTick time.Duration = 100 * time.Millisecond
+
+// Storage that reassembles multiline messages and passes them through the pipeline before they reach the backend
+type Storage struct {
+	storage.Storage
+	pipeline  *Pipeline
+	multiline *Multiline
+}
+
+// Returns storage that applies pipeline to messages of all receivers, imported messages are not processed
+func Wrap(backend storage.Storage, p *Pipeline, m *Multiline) *Storage {
+	return &Storage{Storage: backend, pipeline: p, multiline: m}
+}
+
+func (s *Storage) HandleMessage(msg *storage.Message) {
+	for _, ready := range s.multiline.Add(msg) {
+		s.store(ready)
+	}
+}
+
+// Runs periodic flush of the backend, emits multiline groups which timeout is reached and summaries of processors.
+// On shutdown incomplete groups are passed to the backend before its final flush, the method returns after it
+func (s *Storage) PeriodicFlush(die chan bool) {
+	var (
+		backendDie  chan bool = make(chan bool)
+		backendDone chan bool = make(chan bool)
+	)
+
+	go func() {
+		s.Storage.PeriodicFlush(backendDie)
+		close(backendDone)
+	}()
+
+	ticker := time.NewTicker(multilineTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-die:
+			for _, ready := range s.multiline.Flush() {
+				s.store(ready)
+			}
+
+			for _, summary := range s.pipeline.Summaries(time.Now()) {
+				s.Storage.HandleMessage(summary)
+			}
+
+			close(backendDie)
+			<-backendDone
+
+			return
+		case now := <-ticker.C:
+			for _, ready := range s.multiline.Expire(now) {
+				s.store(ready)
+			}
+
+			// Summaries are not processed, otherwise they could be dropped by the processors they describe
+			for _, summary := range s.pipeline.Summaries(now) {
+				s.Storage.HandleMessage(summary)
+			}
+		}
+	}
+}
+
+func (s *Storage) store(msg *storage.Message) {
+	if s.pipeline.Process(msg) {
+		s.Storage.HandleMessage(msg)
+	}
+}
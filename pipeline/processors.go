@@ -0,0 +1,253 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+)
+
+// References to other fields in values, e.g. «%{host}»
+var reReference *regexp.Regexp = regexp.MustCompile(`%\{([^}]+)\}`)
+
+// Sets field to the value, value may reference other fields
+type setProcessor struct {
+	field    string
+	value    string
+	override bool
+}
+
+func newSetProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &setProcessor{
+		field:    config.Value(c, section, "field"),
+		value:    config.Value(c, section, "value"),
+		override: config.Value(c, section, "override") != "off",
+	}
+
+	if len(p.field) == 0 {
+		return nil, fmt.Errorf("option «field» is required")
+	}
+
+	return p, nil
+}
+
+func (p *setProcessor) Process(msg *storage.Message) (bool, error) {
+	if _, exists := msg.Field(p.field); exists && !p.override {
+		return true, nil
+	}
+
+	value := reReference.ReplaceAllStringFunc(p.value, func(ref string) string {
+		if v, ok := msg.Field(ref[2 : len(ref)-1]); ok {
+			return fmt.Sprint(v)
+		}
+
+		return ""
+	})
+
+	return true, msg.SetField(p.field, value)
+}
+
+// Moves or copies value of the field to the target field
+type renameProcessor struct {
+	field  string
+	target string
+	remove bool
+}
+
+func newRenameProcessor(c *gc.Config, section string, remove bool) (Processor, error) {
+	p := &renameProcessor{
+		field:  config.Value(c, section, "field"),
+		target: config.Value(c, section, "target"),
+		remove: remove,
+	}
+
+	if len(p.field) == 0 || len(p.target) == 0 {
+		return nil, fmt.Errorf("options «field» and «target» are required")
+	}
+
+	return p, nil
+}
+
+func (p *renameProcessor) Process(msg *storage.Message) (bool, error) {
+	value, ok := msg.Field(p.field)
+	if !ok {
+		return true, nil
+	}
+
+	if err := msg.SetField(p.target, value); err != nil {
+		return true, err
+	}
+
+	if p.remove {
+		_, err := msg.RemoveField(p.field)
+
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Removes fields
+type removeProcessor struct {
+	fields []string
+}
+
+func newRemoveProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &removeProcessor{fields: config.SplitList(config.Value(c, section, "fields"))}
+
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("option «fields» is required")
+	}
+
+	return p, nil
+}
+
+func (p *removeProcessor) Process(msg *storage.Message) (bool, error) {
+	for _, field := range p.fields {
+		if _, err := msg.RemoveField(field); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// Converts string fields to lower case
+type lowercaseProcessor struct {
+	fields []string
+}
+
+func newLowercaseProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &lowercaseProcessor{fields: config.SplitList(config.Value(c, section, "fields"))}
+
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("option «fields» is required")
+	}
+
+	return p, nil
+}
+
+func (p *lowercaseProcessor) Process(msg *storage.Message) (bool, error) {
+	for _, field := range p.fields {
+		if value, ok := msg.Field(field); ok {
+			if s, isString := value.(string); isString {
+				if err := msg.SetField(field, strings.ToLower(s)); err != nil {
+					return true, err
+				}
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// Converts value of the field to another type, so storage indexes it properly
+type convertProcessor struct {
+	field string
+	to    string
+}
+
+func newConvertProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &convertProcessor{
+		field: config.Value(c, section, "field"),
+		to:    config.Value(c, section, "convert"),
+	}
+
+	if len(p.field) == 0 {
+		return nil, fmt.Errorf("option «field» is required")
+	}
+
+	switch p.to {
+	case "int", "float", "string", "bool":
+	default:
+		return nil, fmt.Errorf("option «convert» must be one of: int, float, string, bool")
+	}
+
+	return p, nil
+}
+
+func (p *convertProcessor) Process(msg *storage.Message) (bool, error) {
+	value, ok := msg.Field(p.field)
+	if !ok {
+		return true, nil
+	}
+
+	converted, err := convertValue(value, p.to)
+	if err != nil {
+		return true, fmt.Errorf("Unable to convert field «%s» to %s: %v", p.field, p.to, err)
+	}
+
+	return true, msg.SetField(p.field, converted)
+}
+
+// Converts value to int, float, string or bool
+func convertValue(value interface{}, to string) (interface{}, error) {
+	s := strings.TrimSpace(fmt.Sprint(value))
+
+	switch to {
+	case "int":
+		// Parsed directly, so large integers don't lose precision
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+
+		// JSON numbers are decoded as floats, so «42.0» is a valid integer too
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < math.MinInt64 || f >= math.MaxInt64 || f != math.Trunc(f) {
+			return nil, fmt.Errorf("«%s» is not an integer", s)
+		}
+
+		return int64(f), nil
+	case "float":
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		return strconv.ParseBool(s)
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// Sets level from the first present field, names like «WARN» and levels of Python logging are converted to syslog scale
+type levelProcessor struct {
+	fields []string
+}
+
+func newLevelProcessor(c *gc.Config, section string) (Processor, error) {
+	p := &levelProcessor{fields: config.SplitList(config.Value(c, section, "fields"))}
+
+	if len(p.fields) == 0 {
+		p.fields = []string{"extra.level", "extra.levelname", "extra.severity"}
+	}
+
+	return p, nil
+}
+
+func (p *levelProcessor) Process(msg *storage.Message) (bool, error) {
+	for _, field := range p.fields {
+		if value, ok := msg.Field(field); ok {
+			level, err := storage.ParseLevel(value)
+			if err != nil {
+				return true, err
+			}
+
+			msg.SetLevel(level)
+
+			return true, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Drops messages, used with condition
+type dropProcessor struct{}
+
+func (dropProcessor) Process(*storage.Message) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,309 @@
+package pipeline
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/metrics"
+	"github.com/endeveit/recause/storage"
+)
+
+// Detector of sensitive data
+type redactRule struct {
+	name string
+	re   *regexp.Regexp
+	// Group of the expression that is redacted, 0 means the whole match
+	group int
+	// Additional check of the matched text, e.g. checksum of the card number
+	validate func(string) bool
+}
+
+// Built-in detectors in order they are applied, values of «key=value» pairs are replaced first,
+// so masks are not matched by other rules
+var builtinRedactRules []*redactRule = []*redactRule{
+	{
+		name:  "password",
+		re:    regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api_?key|access_?key|token)["']?\s*[=:]\s*("[^"]*"|'[^']*'|[^\s"'&,;]+)`),
+		group: 1,
+	},
+	{
+		name:  "bearer",
+		re:    regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+		group: 1,
+	},
+	{
+		name: "jwt",
+		re:   regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	},
+	{
+		name: "aws_key",
+		re:   regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	},
+	{
+		name:     "pan",
+		re:       regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		validate: isValidPan,
+	},
+	{
+		name: "email",
+		re:   regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`),
+	},
+}
+
+// Values of extra fields with such names are redacted completely by «password» rule
+var reSensitiveKey *regexp.Regexp = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|authorization)`)
+
+// Replaces sensitive data in string fields with masks or keyed hashes
+type redactProcessor struct {
+	name  string
+	rules []*redactRule
+	// Fields to check, empty means all string fields including extra ones
+	fields []string
+	mask   string
+	// Key of HMAC, nil means that masks are used
+	hashKey []byte
+	// Whole values of sensitive extra fields are redacted
+	sensitiveKeys bool
+}
+
+func newRedactProcessor(c *gc.Config, name, section string) (Processor, error) {
+	p := &redactProcessor{
+		name:   name,
+		fields: config.SplitList(config.Value(c, section, "fields")),
+		mask:   config.Value(c, section, "mask"),
+	}
+
+	if len(p.mask) == 0 {
+		p.mask = "[redacted:%{rule}]"
+	}
+
+	switch mode := config.Value(c, section, "mode"); mode {
+	case "", "mask":
+	case "hash":
+		key := config.Value(c, section, "hash_key")
+		if len(key) == 0 {
+			return nil, fmt.Errorf("option «hash_key» is required by hash mode")
+		}
+
+		p.hashKey = []byte(key)
+	default:
+		return nil, fmt.Errorf("unknown mode «%s», use mask or hash", mode)
+	}
+
+	available, err := loadRedactRules(c)
+	if err != nil {
+		return nil, err
+	}
+
+	names := config.SplitList(config.Value(c, section, "rules"))
+	if len(names) == 0 {
+		p.rules = available
+	}
+
+	for _, ruleName := range names {
+		rule := findRedactRule(available, ruleName)
+		if rule == nil {
+			return nil, fmt.Errorf("unknown rule «%s»", ruleName)
+		}
+
+		p.rules = append(p.rules, rule)
+	}
+
+	for _, rule := range p.rules {
+		if rule.name == "password" {
+			p.sensitiveKeys = true
+		}
+	}
+
+	return p, nil
+}
+
+// Returns built-in rules followed by custom ones from «[redact_patterns]» section
+func loadRedactRules(c *gc.Config) ([]*redactRule, error) {
+	rules := append([]*redactRule{}, builtinRedactRules...)
+
+	if !c.HasSection("redact_patterns") {
+		return rules, nil
+	}
+
+	names, _ := c.SectionOptions("redact_patterns")
+	sort.Strings(names)
+
+	for _, name := range names {
+		re, err := regexp.Compile(config.Value(c, "redact_patterns", name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern «%s»: %v", name, err)
+		}
+
+		// Custom pattern with groups redacts the first one, e.g. «session=(\w+)»
+		rule := &redactRule{name: name, re: re}
+		if re.NumSubexp() > 0 {
+			rule.group = 1
+		}
+
+		// Built-in rules are shared, so the overridden one is replaced in the copy of the list only
+		if i := findRedactRuleIndex(rules, name); i >= 0 {
+			rules[i] = rule
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func findRedactRule(rules []*redactRule, name string) *redactRule {
+	if i := findRedactRuleIndex(rules, name); i >= 0 {
+		return rules[i]
+	}
+
+	return nil
+}
+
+func findRedactRuleIndex(rules []*redactRule, name string) int {
+	for i := range rules {
+		if rules[i].name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (p *redactProcessor) Process(msg *storage.Message) (bool, error) {
+	fields := p.fields
+
+	if len(fields) == 0 {
+		fields = []string{"host", "short_message", "full_message", "facility", "file"}
+		for key := range msg.Extra {
+			fields = append(fields, "extra."+key)
+		}
+	}
+
+	for _, field := range fields {
+		value, ok := msg.Field(field)
+		if !ok {
+			continue
+		}
+
+		sensitive := p.sensitiveKeys && strings.HasPrefix(field, "extra.") && reSensitiveKey.MatchString(field[6:])
+
+		var err error
+
+		switch v := value.(type) {
+		case string:
+			err = msg.SetField(field, p.redact(v, sensitive))
+		case []interface{}:
+			redacted := make([]interface{}, len(v))
+			for i, item := range v {
+				if s, isString := item.(string); isString {
+					redacted[i] = p.redact(s, sensitive)
+				} else {
+					redacted[i] = item
+				}
+			}
+
+			err = msg.SetField(field, redacted)
+		default:
+			if sensitive {
+				err = msg.SetField(field, p.replacement("password", fmt.Sprint(v)))
+			}
+		}
+
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// Returns text with sensitive data replaced, sensitive text is replaced completely
+func (p *redactProcessor) redact(text string, sensitive bool) string {
+	if sensitive && len(text) > 0 {
+		return p.replacement("password", text)
+	}
+
+	for _, rule := range p.rules {
+		matches := rule.re.FindAllStringSubmatchIndex(text, -1)
+		if matches == nil {
+			continue
+		}
+
+		var (
+			result bytes.Buffer
+			last   int
+		)
+
+		for _, m := range matches {
+			start, end := m[2*rule.group], m[2*rule.group+1]
+			if start < 0 || (rule.validate != nil && !rule.validate(text[start:end])) {
+				continue
+			}
+
+			result.WriteString(text[last:start])
+			result.WriteString(p.replacement(rule.name, text[start:end]))
+			last = end
+		}
+
+		if last > 0 {
+			result.WriteString(text[last:])
+			text = result.String()
+		}
+	}
+
+	return text
+}
+
+// Returns mask or keyed hash of the value, hashes allow to correlate values without revealing them
+func (p *redactProcessor) replacement(rule, value string) string {
+	metrics.Redactions.With(p.name, rule).Inc()
+
+	if p.hashKey != nil {
+		mac := hmac.New(sha256.New, p.hashKey)
+		_, _ = mac.Write([]byte(value))
+
+		return "[" + rule + ":" + hex.EncodeToString(mac.Sum(nil))[:16] + "]"
+	}
+
+	return strings.Replace(p.mask, "%{rule}", rule, -1)
+}
+
+// Checks length and Luhn checksum of the card number, separators are ignored
+func isValidPan(text string) bool {
+	var digits []int
+
+	for _, r := range text {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+	}
+
+	return sum%10 == 0
+}
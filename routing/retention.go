@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"fmt"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/match"
+)
+
+// Rule that assigns retention policy to matching messages
+type retentionRule struct {
+	name      string
+	condition *match.Matcher
+}
+
+// Reads conditions of policies listed in «[retention] policies», the first matching policy wins
+func readRetentionRules(c *gc.Config) ([]*retentionRule, error) {
+	policies, err := storage.ReadRetentionPolicies(c)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []*retentionRule{}
+
+	for _, policy := range policies {
+		condition := config.Value(c, storage.RETENTION_SECTION_PREFIX+policy.Name, "if")
+		if len(condition) == 0 {
+			return nil, fmt.Errorf("Retention policy «%s» doesn't have condition", policy.Name)
+		}
+
+		matcher, err := match.Compile(condition)
+		if err != nil {
+			return nil, fmt.Errorf("Retention policy «%s» has invalid condition: %v", policy.Name, err)
+		}
+
+		rules = append(rules, &retentionRule{name: policy.Name, condition: matcher})
+	}
+
+	return rules, nil
+}
+
+// Returns retention stats of all backends, counters are summed up and the oldest message is chosen
+func (r *Router) GetRetentionStats(q *storage.SearchQuery) ([]*storage.RetentionStats, error) {
+	var (
+		result []*storage.RetentionStats
+		byName map[string]*storage.RetentionStats = make(map[string]*storage.RetentionStats)
+	)
+
+	for _, backend := range r.getBackends() {
+		stats, err := backend.GetRetentionStats(q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range stats {
+			existing, ok := byName[item.Name]
+			if !ok {
+				byName[item.Name] = item
+				result = append(result, item)
+
+				continue
+			}
+
+			existing.Messages += item.Messages
+
+			if item.Oldest != nil && (existing.Oldest == nil || item.Oldest.Before(*existing.Oldest)) {
+				existing.Oldest = item.Oldest
+			}
+		}
+	}
+
+	return result, nil
+}
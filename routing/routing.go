@@ -0,0 +1,438 @@
+// Package routing chooses storage backend, index and retention policy of every message according to
+// «route:<name>» and «retention:<name>» sections.
+// Routes are evaluated in order listed in «[routing] routes», the first matching route wins
+package routing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/metrics"
+	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/match"
+)
+
+// Name of the route used when no route matches and «[routing] default» is not set
+const DEFAULT_ROUTE string = "default"
+
+// Returns storage backend by its name
+type BackendFactory func(name string) (storage.Storage, error)
+
+type route struct {
+	name string
+	// Messages matching the condition are sent to the route, nil means all messages
+	condition *match.Matcher
+	backend   string
+}
+
+// Storage that sends messages to backends chosen by routes, searches are performed in all used backends
+type Router struct {
+	primary  string
+	backends map[string]storage.Storage
+	routes   []*route
+	fallback *route
+	// Rules of retention policies, messages that don't match any of them have no policy
+	retention []*retentionRule
+	mutex     *sync.RWMutex
+}
+
+// Returns router described in the config, backends used by routes are created by factory
+func New(c *gc.Config, primary string, factory BackendFactory) (*Router, error) {
+	routes, fallback, err := readRoutes(c, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := readRetentionRules(c)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Router{
+		primary:   primary,
+		backends:  make(map[string]storage.Storage),
+		routes:    routes,
+		fallback:  fallback,
+		retention: retention,
+		mutex:     &sync.RWMutex{},
+	}
+
+	// Primary backend is always created, it handles imports and query validation
+	names := []string{primary}
+	for _, rt := range allRoutes(routes, fallback) {
+		names = append(names, rt.backend)
+	}
+
+	for _, name := range names {
+		if _, ok := r.backends[name]; ok {
+			continue
+		}
+
+		if r.backends[name], err = factory(name); err != nil {
+			return nil, err
+		}
+	}
+
+	config.RegisterReloadable(
+		"routing.*",
+		storage.ROUTE_SECTION_PREFIX+"*.*",
+		"retention.*",
+		storage.RETENTION_SECTION_PREFIX+"*.*",
+	)
+
+	return r, nil
+}
+
+// Validates routes and retention policies described in the config
+func Check(c *gc.Config, primary string) error {
+	if _, _, err := readRoutes(c, primary); err != nil {
+		return err
+	}
+
+	if _, err := readRetentionRules(c); err != nil {
+		return err
+	}
+
+	_, err := storage.ReadIndexRoutes(c)
+
+	return err
+}
+
+// Reads routes listed in «[routing] routes» and the route used for messages that don't match any of them
+func readRoutes(c *gc.Config, primary string) ([]*route, *route, error) {
+	var (
+		routes []*route
+		seen   map[string]bool = make(map[string]bool)
+	)
+
+	for _, name := range config.SplitList(config.Value(c, "routing", "routes")) {
+		if seen[name] {
+			return nil, nil, fmt.Errorf("Route «%s» is listed twice", name)
+		}
+
+		seen[name] = true
+
+		rt, err := newRoute(c, name, primary)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		routes = append(routes, rt)
+	}
+
+	fallback := &route{name: DEFAULT_ROUTE, backend: primary}
+
+	if name := config.Value(c, "routing", "default"); len(name) > 0 {
+		rt, err := newRoute(c, name, primary)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if rt.condition != nil {
+			return nil, nil, fmt.Errorf("Default route «%s» can't have condition", name)
+		}
+
+		fallback = rt
+	}
+
+	return routes, fallback, nil
+}
+
+func newRoute(c *gc.Config, name, primary string) (*route, error) {
+	section := storage.ROUTE_SECTION_PREFIX + name
+	if !c.HasSection(section) {
+		return nil, fmt.Errorf("Section [%s] is missing", section)
+	}
+
+	rt := &route{name: name, backend: config.Value(c, section, "backend")}
+
+	if len(rt.backend) == 0 {
+		rt.backend = primary
+	}
+
+	switch rt.backend {
+	case "elastic", "bleve":
+	default:
+		return nil, fmt.Errorf("Route «%s» has unknown backend «%s»", name, rt.backend)
+	}
+
+	// Only elastic stores messages of different routes in different indices
+	if len(config.Value(c, section, "index")) > 0 && rt.backend != "elastic" {
+		return nil, fmt.Errorf("Route «%s» has index, but indices are supported by elastic backend only", name)
+	}
+
+	if condition := config.Value(c, section, "if"); len(condition) > 0 {
+		matcher, err := match.Compile(condition)
+		if err != nil {
+			return nil, fmt.Errorf("Route «%s» has invalid condition: %v", name, err)
+		}
+
+		rt.condition = matcher
+	}
+
+	return rt, nil
+}
+
+// Assigns retention policy and sends message to the backend of the first matching route
+func (r *Router) HandleMessage(msg *storage.Message) {
+	rt, retention := r.match(msg)
+
+	msg.Route = rt.name
+	msg.Retention = retention
+	metrics.MessagesRouted.With(rt.name).Inc()
+
+	r.backends[rt.backend].HandleMessage(msg)
+}
+
+// Returns message from the first backend that has it
+func (r *Router) GetMessage(tenant, msgId string) (doc map[string]interface{}, err error) {
+	for _, backend := range r.getBackends() {
+		if doc, err = backend.GetMessage(tenant, msgId); err == nil {
+			return doc, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Searches messages in all backends and merges results ordered by timestamp
+func (r *Router) GetMessages(q *storage.SearchQuery) (*storage.SearchResult, error) {
+	backends := r.getBackends()
+	if len(backends) == 1 {
+		return backends[0].GetMessages(q)
+	}
+
+	// Every backend returns messages from the beginning, so the page is cut from the merged list
+	sub := *q
+	sub.Offset = 0
+	sub.Limit = q.Offset + q.Limit
+
+	result := &storage.SearchResult{
+		Limit:    q.Limit,
+		Offset:   q.Offset,
+		Messages: []storage.Message{},
+	}
+
+	for _, backend := range backends {
+		rs, err := backend.GetMessages(&sub)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Total += rs.Total
+		result.Messages = append(result.Messages, rs.Messages...)
+
+		if rs.TookMs > result.TookMs {
+			result.TookMs = rs.TookMs
+		}
+	}
+
+	sort.SliceStable(result.Messages, func(i, j int) bool {
+		if q.Ascending {
+			return result.Messages[i].Timestamp.Before(result.Messages[j].Timestamp)
+		}
+
+		return result.Messages[i].Timestamp.After(result.Messages[j].Timestamp)
+	})
+
+	if q.Offset >= len(result.Messages) {
+		result.Messages = []storage.Message{}
+	} else {
+		result.Messages = result.Messages[q.Offset:]
+	}
+
+	if len(result.Messages) > q.Limit {
+		result.Messages = result.Messages[:q.Limit]
+	}
+
+	return result, nil
+}
+
+// Sums histograms of all backends
+func (r *Router) GetHistogram(q *storage.SearchQuery, nbBuckets int) (*storage.Histogram, error) {
+	var result *storage.Histogram
+
+	for _, backend := range r.getBackends() {
+		h, err := backend.GetHistogram(q, nbBuckets)
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			result = h
+
+			continue
+		}
+
+		for i := range result.Buckets {
+			result.Buckets[i].Count += h.Buckets[i].Count
+		}
+	}
+
+	return result, nil
+}
+
+// Returns health of the primary backend, storage isn't reachable if any of backends isn't
+func (r *Router) Health() *storage.Health {
+	backends := r.getBackends()
+	health := backends[0].Health()
+
+	for _, backend := range backends[1:] {
+		h := backend.Health()
+
+		health.Buffered += h.Buffered
+
+		if !h.Reachable && health.Reachable {
+			health.Reachable = false
+			health.Error = fmt.Sprintf("Backend «%s»: %s", h.Backend, h.Error)
+		}
+	}
+
+	return health
+}
+
+// Imports messages to the primary backend, imported messages are not routed
+func (r *Router) ImportMessages(messages []*storage.Message) error {
+	return r.backends[r.primary].ImportMessages(messages)
+}
+
+// Runs periodic flush of all backends, returns when all of them made the final flush
+func (r *Router) PeriodicFlush(die chan bool) {
+	wg := &sync.WaitGroup{}
+	wg.Add(len(r.backends))
+
+	for _, backend := range r.backends {
+		go func(backend storage.Storage) {
+			defer wg.Done()
+
+			backend.PeriodicFlush(die)
+		}(backend)
+	}
+
+	wg.Wait()
+}
+
+// Validates query with every backend, searches are sent to all of them and their syntax differs
+func (r *Router) ValidateQuery(tenant, query string) error {
+	for _, backend := range r.getBackends() {
+		if err := backend.ValidateQuery(tenant, query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads routes from the new config and prepares reload of all backends, returned function applies them
+func (r *Router) PrepareReload(c *gc.Config) (func(), error) {
+	routes, fallback, err := readRoutes(c, r.primary)
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := readRetentionRules(c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rt := range allRoutes(routes, fallback) {
+		if _, ok := r.backends[rt.backend]; !ok {
+			return nil, fmt.Errorf("Route «%s» uses backend «%s» which requires restart", rt.name, rt.backend)
+		}
+	}
+
+	appliers := []func(){}
+
+	for _, backend := range r.backends {
+		if reloadable, ok := backend.(config.Reloadable); ok {
+			apply, err := reloadable.PrepareReload(c)
+			if err != nil {
+				return nil, err
+			}
+
+			appliers = append(appliers, apply)
+		}
+	}
+
+	return func() {
+		r.mutex.Lock()
+		r.routes = routes
+		r.fallback = fallback
+		r.retention = retention
+		r.mutex.Unlock()
+
+		for _, apply := range appliers {
+			apply()
+		}
+	}, nil
+}
+
+// Returns names of routes in order they are evaluated followed by the default route
+func (r *Router) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := []string{}
+	for _, rt := range allRoutes(r.routes, r.fallback) {
+		names = append(names, rt.name)
+	}
+
+	return names
+}
+
+// Returns the first route and the first retention policy matching the message
+func (r *Router) match(msg *storage.Message) (*route, string) {
+	var (
+		matched   *route
+		retention string
+	)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, rt := range r.routes {
+		if rt.condition == nil || rt.condition.Match(msg) {
+			matched = rt
+
+			break
+		}
+	}
+
+	if matched == nil {
+		matched = r.fallback
+	}
+
+	for _, rule := range r.retention {
+		if rule.condition.Match(msg) {
+			retention = rule.name
+
+			break
+		}
+	}
+
+	return matched, retention
+}
+
+// Returns routes followed by the default route
+func allRoutes(routes []*route, fallback *route) []*route {
+	result := make([]*route, 0, len(routes)+1)
+
+	return append(append(result, routes...), fallback)
+}
+
+// Returns backends with the primary one first
+func (r *Router) getBackends() []storage.Storage {
+	backends := []storage.Storage{r.backends[r.primary]}
+
+	for name, backend := range r.backends {
+		if name != r.primary {
+			backends = append(backends, backend)
+		}
+	}
+
+	return backends
+}
@@ -1,39 +1,46 @@
-// -build
 package bleve
 
-// Bleve storage will be used when the sorting will be implemented.
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	bv "github.com/blevesearch/bleve"
 	bvKeywordAnalyzer "github.com/blevesearch/bleve/analysis/analyzers/keyword_analyzer"
 	bvStandardAnalyzer "github.com/blevesearch/bleve/analysis/analyzers/standard_analyzer"
-	"github.com/endeveit/go-gelf/gelf"
 	"github.com/endeveit/go-snippets/cli"
-	"github.com/endeveit/go-snippets/config"
-	"github.com/satori/go.uuid"
+	gc "github.com/robfig/config"
 
+	"github.com/endeveit/recause/config"
 	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
 	"github.com/endeveit/recause/storage"
 )
 
 // Structure that used to encapsulate all work with bleve in a single object
 type Bleve struct {
-	batchSize          int
-	index              bv.Index
+	settings           *storage.FlushSettings
+	datapath           string
+	indices            map[string]bv.Index
+	mutexIndices       *sync.Mutex
 	messages           []*storage.Message
 	mutexHandleMessage *sync.RWMutex
 	mutexFlushMessages *sync.RWMutex
-	intervalCleanup    time.Duration
-	intervalFlush      time.Duration
+	mutexSettings      *sync.RWMutex
+	tenants            *storage.Tenants
+	policies           []*storage.RetentionPolicy
 	lastFlush          time.Time
 }
 
 const DOC_TYPE string = "message"
 
+var ErrNotFound error = errors.New("Message not found")
+
 // Returns object to work with bleve
 func NewBleveStorage() *Bleve {
 	datapath, err := config.Instance().String("bleve", "datapath")
@@ -55,229 +62,762 @@ func NewBleveStorage() *Bleve {
 		os.Exit(1)
 	}
 
-	batchSize, err := config.Instance().Int("bleve", "batch_size")
+	// Invalid values are replaced with defaults here, reload rejects them
+	settings, _ := storage.ReadFlushSettings(config.Instance(), "bleve")
+
+	tenants, err := storage.NewTenants(config.Instance(), settings.IntervalCleanup)
 	if err != nil {
-		batchSize = 10
+		logger.Instance().
+			WithError(err).
+			Error("Unable to load tenants settings")
+
+		os.Exit(1)
 	}
 
-	var (
-		defaultIntervalSecond string = "1s"
-		defaultIntervalMonth  string = "720h"
-		index                 bv.Index
-	)
+	policies, err := storage.ReadRetentionPolicies(config.Instance())
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Error("Unable to load retention policies")
+
+		os.Exit(1)
+	}
+
+	b := &Bleve{
+		settings:           settings,
+		datapath:           datapath,
+		indices:            make(map[string]bv.Index),
+		mutexIndices:       &sync.Mutex{},
+		messages:           []*storage.Message{},
+		mutexHandleMessage: &sync.RWMutex{},
+		mutexFlushMessages: &sync.RWMutex{},
+		mutexSettings:      &sync.RWMutex{},
+		tenants:            tenants,
+		policies:           policies,
+		lastFlush:          time.Now(),
+	}
+
+	config.RegisterReloadable(storage.ReloadableFlushOptions("bleve")...)
 
-	intervalCleanupStr, err := config.Instance().String("bleve", "interval_cleanup")
+	metrics.BufferMessages.Set(func() float64 {
+		b.mutexHandleMessage.RLock()
+		defer b.mutexHandleMessage.RUnlock()
+
+		return float64(len(b.messages))
+	}, "bleve")
+
+	// Index of the default tenant is opened at start to fail early
+	_, err = b.getIndex(storage.DefaultTenant(), true)
 	if err != nil {
-		intervalCleanupStr = defaultIntervalMonth
+		os.Exit(1)
 	}
 
-	intervalCleanup, err := time.ParseDuration(intervalCleanupStr)
+	return b
+}
+
+// Returns message from bleve index
+func (b *Bleve) GetMessage(tenant, msgId string) (doc map[string]interface{}, err error) {
+	index, err := b.getIndex(tenant, false)
 	if err != nil {
-		intervalCleanup, _ = time.ParseDuration(defaultIntervalMonth)
+		return nil, err
+	} else if index == nil {
+		return nil, ErrNotFound
 	}
 
-	intervalFlushStr, err := config.Instance().String("bleve", "interval_flush")
+	bvRequest := bv.NewSearchRequest(bv.NewDocIDQuery([]string{msgId}))
+	bvRequest.Fields = []string{"*"}
+
+	bvResults, err := index.Search(bvRequest)
 	if err != nil {
-		intervalFlushStr = defaultIntervalSecond
+		return nil, err
+	}
+
+	if bvResults.Hits.Len() == 0 {
+		return nil, ErrNotFound
 	}
 
-	intervalFlush, err := time.ParseDuration(intervalFlushStr)
+	msg := getMessageFromFields(bvResults.Hits[0].ID, bvResults.Hits[0].Fields)
+	msg.Tenant = tenant
+
+	b2, err := json.Marshal(msg)
 	if err != nil {
-		intervalFlush, _ = time.ParseDuration(defaultIntervalSecond)
+		return nil, err
 	}
 
-	if !cli.FileExists(datapath) {
-		index, err = bv.New(datapath, getIndexMapping())
+	err = json.Unmarshal(b2, &doc)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			logger.Instance().
-				WithError(err).
-				Error("Unable to create bleve index")
+	return doc, nil
+}
+
+// Searches for messages
+func (b *Bleve) GetMessages(q *storage.SearchQuery) (result *storage.SearchResult, err error) {
+	result = &storage.SearchResult{
+		Limit:    q.Limit,
+		Offset:   q.Offset,
+		Messages: []storage.Message{},
+	}
+
+	index, err := b.getIndex(q.Tenant, false)
+	if err != nil {
+		return nil, err
+	} else if index == nil {
+		// Tenant didn't send any messages yet
+		return result, nil
+	}
+
+	bvRequest := bv.NewSearchRequestOptions(getQuery(q), q.Limit, q.Offset, false)
+	bvRequest.Fields = []string{"*"}
+	if q.Ascending {
+		bvRequest.SortBy([]string{"timestamp", "_id"})
+	} else {
+		bvRequest.SortBy([]string{"-timestamp", "-_id"})
+	}
+
+	searchStarted := time.Now()
+	bvResults, err := index.Search(bvRequest)
+	metrics.SearchDuration.With("bleve").ObserveSince(searchStarted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Total = int64(bvResults.Total)
+	result.TookMs = int64(bvResults.Took / time.Millisecond)
+
+	for _, hit := range bvResults.Hits {
+		msg := getMessageFromFields(hit.ID, hit.Fields)
+		msg.Tenant = q.Tenant
+
+		result.Messages = append(result.Messages, *msg)
+	}
+
+	return result, nil
+}
+
+// Counts messages matching the query in buckets of the histogram
+func (b *Bleve) GetHistogram(q *storage.SearchQuery, nbBuckets int) (*storage.Histogram, error) {
+	h, err := storage.NewHistogram(q, nbBuckets, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := b.getIndex(q.Tenant, false)
+	if err != nil {
+		return nil, err
+	} else if index == nil {
+		return h, nil
+	}
+
+	facet := bv.NewFacetRequest("timestamp", len(h.Buckets))
+	for i := range h.Buckets {
+		facet.AddDateTimeRange(strconv.Itoa(i), h.Buckets[i].From, h.BucketEnd(i))
+	}
+
+	bvRequest := bv.NewSearchRequestOptions(getQuery(q), 0, 0, false)
+	bvRequest.AddFacet("histogram", facet)
+
+	searchStarted := time.Now()
+	bvResults, err := index.Search(bvRequest)
+	metrics.SearchDuration.With("bleve").ObserveSince(searchStarted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok := bvResults.Facets["histogram"]; ok {
+		for _, dateRange := range result.DateRanges {
+			i, err := strconv.Atoi(dateRange.Name)
+			if err == nil && i >= 0 && i < len(h.Buckets) {
+				h.Buckets[i].Count = int64(dateRange.Count)
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// Counts messages of every retention class and finds the oldest of them
+func (b *Bleve) GetRetentionStats(q *storage.SearchQuery) ([]*storage.RetentionStats, error) {
+	policies := b.getPolicies()
+	stats := storage.NewRetentionStats(policies)
+
+	index, err := b.getIndex(q.Tenant, false)
+	if err != nil {
+		return nil, err
+	} else if index == nil {
+		return stats, nil
+	}
+
+	for _, item := range stats {
+		var bvQuery bv.Query
 
-			os.Exit(1)
+		if item.Name == storage.DEFAULT_RETENTION_CLASS {
+			bvQuery = bv.NewBooleanQuery([]bv.Query{getQuery(q)}, nil, getRetentionExclusion(policies))
 		} else {
-			logger.Instance().
-				Debug("New bleve index created")
+			bvQuery = bv.NewConjunctionQuery([]bv.Query{getQuery(q), getRetentionClassesQuery([]string{item.Name})})
 		}
-	} else {
-		index, err = bv.Open(datapath)
 
+		bvRequest := bv.NewSearchRequestOptions(bvQuery, 1, 0, false)
+		bvRequest.Fields = []string{"timestamp"}
+		bvRequest.SortBy([]string{"timestamp"})
+
+		bvResults, err := index.Search(bvRequest)
 		if err != nil {
-			logger.Instance().
-				WithError(err).
-				Error("Unable to open bleve index")
+			return nil, err
+		}
 
-			os.Exit(1)
-		} else {
-			logger.Instance().
-				Debug("Bleve index successfully opened")
+		item.Messages = int64(bvResults.Total)
+
+		if bvResults.Hits.Len() > 0 {
+			msg := getMessageFromFields(bvResults.Hits[0].ID, bvResults.Hits[0].Fields)
+			item.Oldest = &msg.Timestamp
 		}
 	}
 
-	return &Bleve{
-		batchSize:          batchSize,
-		index:              index,
-		messages:           []*storage.Message{},
-		mutexHandleMessage: &sync.RWMutex{},
-		mutexFlushMessages: &sync.RWMutex{},
-		intervalCleanup:    -intervalCleanup,
-		intervalFlush:      intervalFlush,
-		lastFlush:          time.Now(),
-	}
+	return stats, nil
 }
 
-// Handles GELF-message received through UDP
-func (b *Bleve) HandleMessage(msg *gelf.Message) {
+// Handles message received by one of receivers
+func (b *Bleve) HandleMessage(msg *storage.Message) {
+	_, tenants := b.getSettings()
+
+	if !tenants.Allow(msg.Tenant) {
+		return
+	}
+
+	storage.Live().Publish(msg)
+
 	b.mutexHandleMessage.Lock()
 	defer b.mutexHandleMessage.Unlock()
 
-	b.messages = append(b.messages, storage.NewMessageFromGelf(msg))
+	b.messages = append(b.messages, msg)
+}
+
+// Writes messages immediately bypassing buffer and quotas, identifiers of messages are preserved
+func (b *Bleve) ImportMessages(messages []*storage.Message) error {
+	bvBatches := make(map[string]*bv.Batch)
+
+	for _, message := range messages {
+		if _, ok := bvBatches[message.Tenant]; !ok {
+			index, err := b.getIndex(message.Tenant, true)
+			if err != nil {
+				return err
+			}
+
+			bvBatches[message.Tenant] = index.NewBatch()
+		}
+
+		if len(message.Id) == 0 {
+			message.Id = storage.MessageId(message)
+		}
+
+		if err := bvBatches[message.Tenant].Index(message.Id, message); err != nil {
+			return err
+		}
+	}
+
+	for tenant, bvBatch := range bvBatches {
+		index, err := b.getIndex(tenant, true)
+		if err != nil {
+			return err
+		}
+
+		if err = index.Batch(bvBatch); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Periodically flushes messages to bleve index
+// Periodically flushes messages to bleve index, buffered messages are flushed and indices are closed before return
 func (b *Bleve) PeriodicFlush(die chan bool) {
 	var (
-		bvBatchIndex  *bv.Batch
+		bvBatches     map[string]*bv.Batch
 		err           error
 		nbMessages    int
+		stopping      bool
 		sleepDuration time.Duration = 3 * time.Second
+		cleanupDone   chan bool     = make(chan bool)
 	)
 
 	// Run periodic cleanup task
-	go b.periodicCleanup(die)
+	go func() {
+		b.periodicCleanup(die)
+		close(cleanupDone)
+	}()
 
 	for {
 		select {
 		case <-die:
-			return
+			stopping = true
 		default:
 		}
 
 		nbMessages = len(b.messages)
+		settings, _ := b.getSettings()
 
-		if nbMessages > 0 && (nbMessages >= b.batchSize || time.Now().Sub(b.lastFlush) > b.intervalFlush) {
+		if nbMessages > 0 && (stopping || nbMessages >= settings.BatchSize || time.Now().Sub(b.lastFlush) > settings.IntervalFlush) {
 			b.mutexFlushMessages.Lock()
 
-			bvBatchIndex = b.index.NewBatch()
+			b.mutexHandleMessage.Lock()
+			messages := b.messages
+			b.messages = []*storage.Message{}
+			b.mutexHandleMessage.Unlock()
+
+			// Every tenant has its own index, so messages are split into several batches
+			bvBatches = make(map[string]*bv.Batch)
+			failed := []*storage.Message{}
+			failedTenants := make(map[string]bool)
+
+			for _, message := range messages {
+				index, err := b.getIndex(message.Tenant, true)
+				if err != nil {
+					failed = append(failed, message)
+					continue
+				}
+
+				if _, ok := bvBatches[message.Tenant]; !ok {
+					bvBatches[message.Tenant] = index.NewBatch()
+				}
+
+				// Identifier is kept between attempts, so retries don't create duplicates
+				if len(message.Id) == 0 {
+					message.Id = storage.MessageId(message)
+				}
 
-			for _, message := range b.messages {
-				err = bvBatchIndex.Index(uuid.NewV4().String(), message)
+				err = bvBatches[message.Tenant].Index(message.Id, message)
 				if err != nil {
 					logger.Instance().
 						WithError(err).
 						Warning("Unable to add message to batch")
+
+					metrics.FlushFailures.With("bleve", "document").Inc()
 				}
 			}
 
-			if bvBatchIndex.Size() > 0 {
-				err = b.index.Batch(bvBatchIndex)
+			for tenant, bvBatchIndex := range bvBatches {
+				if bvBatchIndex.Size() == 0 {
+					continue
+				}
+
+				index, _ := b.getIndex(tenant, true)
+
+				flushStarted := time.Now()
+				err = index.Batch(bvBatchIndex)
+				metrics.FlushDuration.With("bleve").ObserveSince(flushStarted)
 
 				if err != nil {
 					logger.Instance().
 						WithError(err).
+						WithField("tenant", tenant).
 						Warning("Unable to batch index messages")
+
+					metrics.FlushFailures.With("bleve", "batch").Add(float64(bvBatchIndex.Size()))
+					failedTenants[tenant] = true
 				} else {
+					metrics.FlushBatchSize.With("bleve").Observe(float64(bvBatchIndex.Size()))
+
 					logger.Instance().
+						WithField("tenant", tenant).
 						WithField("nb_messages", bvBatchIndex.Size()).
 						Info("Messages successfully indexed")
+				}
+			}
 
-					b.lastFlush = time.Now()
-					b.messages = []*storage.Message{}
+			for _, message := range messages {
+				if failedTenants[message.Tenant] {
+					failed = append(failed, message)
 				}
 			}
 
+			// Messages that were not indexed will be retried with the next batch
+			b.mutexHandleMessage.Lock()
+			b.messages = append(failed, b.messages...)
+			b.mutexHandleMessage.Unlock()
+
+			b.lastFlush = time.Now()
+
 			b.mutexFlushMessages.Unlock()
 		}
 
+		if stopping {
+			<-cleanupDone
+
+			if nbMessages = len(b.messages); nbMessages > 0 {
+				logger.Instance().
+					WithField("nb_messages", nbMessages).
+					Warning("Messages were not flushed before shutdown")
+			}
+			b.closeIndices()
+
+			return
+		}
+
 		time.Sleep(sleepDuration)
 	}
 }
 
-// Periodically removes old entries from index
+// Checks if index of the default tenant is readable and returns number of buffered messages
+func (b *Bleve) Health() *storage.Health {
+	b.mutexHandleMessage.RLock()
+	buffered := len(b.messages)
+	b.mutexHandleMessage.RUnlock()
+
+	health := &storage.Health{
+		Backend:  "bleve",
+		Buffered: buffered,
+	}
+
+	index, err := b.getIndex(storage.DefaultTenant(), true)
+	if err != nil {
+		health.Error = err.Error()
+
+		return health
+	}
+
+	nbDocuments, err := index.DocCount()
+	if err != nil {
+		health.Error = err.Error()
+
+		return health
+	}
+
+	health.Reachable = true
+	health.Details = map[string]interface{}{
+		"nb_indices":   len(b.getOpenedIndices()),
+		"nb_documents": nbDocuments,
+	}
+
+	return health
+}
+
+// Validates search query, syntax doesn't depend on the tenant
+func (b *Bleve) ValidateQuery(tenant, query string) error {
+	return bv.NewQueryStringQuery(query).Validate()
+}
+
+// Periodically removes old entries from indices
 func (b *Bleve) periodicCleanup(die chan bool) {
+	sleepDuration := 3 * time.Second
+
+	for {
+		select {
+		case <-die:
+			return
+		default:
+		}
+
+		_, tenants := b.getSettings()
+		policies := b.getPolicies()
+
+		for tenant, index := range b.getOpenedIndices() {
+			// Messages of retention policies are removed according to the policy
+			bvNbCleaned := b.cleanupIndex(tenant, index, bv.NewBooleanQuery(
+				[]bv.Query{getTimestampBeforeQuery(time.Now().Add(-tenants.Retention(tenant)))},
+				nil,
+				getRetentionExclusion(policies)))
+
+			for _, policy := range policies {
+				bvNbCleaned += b.cleanupIndex(tenant, index, bv.NewConjunctionQuery([]bv.Query{
+					getRetentionClassesQuery([]string{policy.Name}),
+					getTimestampBeforeQuery(time.Now().Add(-policy.Period)),
+				}))
+			}
+
+			if bvNbCleaned > 0 {
+				logger.Instance().
+					WithField("tenant", tenant).
+					WithField("nb_messages", bvNbCleaned).
+					Infof("Obsolete messages were deleted from index")
+			}
+		}
+
+		time.Sleep(sleepDuration)
+	}
+}
+
+// Removes messages matching the query from the index, returns number of removed messages
+func (b *Bleve) cleanupIndex(tenant string, index bv.Index, bvQuery bv.Query) int {
 	var (
-		bvBatchDelete *bv.Batch
-		bvRequest     *bv.SearchRequest
-		bvResults     *bv.SearchResult
-		bvCleaningNow bool
-		bvNbCleaned   int
-		err           error
-		till          string
-		limit         int           = 20
-		offset        int           = 0
-		sleepDuration time.Duration = 3 * time.Second
+		bvNbCleaned int
+		limit       int = 20
 	)
 
-	defer func() {
-		err = b.index.Close()
+	for {
+		// Deleted documents disappear from results, so offset is always zero
+		bvResults, err := index.Search(bv.NewSearchRequestOptions(bvQuery, limit, 0, false))
 		if err != nil {
 			logger.Instance().
 				WithError(err).
-				Warning("Unable to close Bleve index")
+				WithField("tenant", tenant).
+				Warning("Unable to get obsolete messages from index")
+
+			return bvNbCleaned
 		}
-	}()
 
-	for {
-		select {
-		case <-die:
-			return
-		default:
+		if bvResults.Hits.Len() == 0 {
+			return bvNbCleaned
 		}
 
-		offset = 0
-		bvNbCleaned = 0
-		bvCleaningNow = true
-		till = time.Now().Add(b.intervalCleanup).Format(time.RFC3339)
-		bvQuery := bv.NewDateRangeQuery(nil, &till)
-		bvQuery.FieldVal = "timestamp"
+		// List of documents to be deleted
+		bvBatchDelete := index.NewBatch()
+		for _, hit := range bvResults.Hits {
+			bvBatchDelete.Delete(hit.ID)
+		}
 
-		for bvCleaningNow != false {
-			bvRequest = bv.NewSearchRequestOptions(bvQuery, limit, offset, false)
-			bvResults, err = b.index.Search(bvRequest)
+		// Batch delete them
+		err = index.Batch(bvBatchDelete)
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("tenant", tenant).
+				Warning("Unable to delete obsolete messages from index")
 
-			if err != nil {
-				logger.Instance().
-					WithError(err).
-					Warning("Unable to get obsolete messages from index")
+			return bvNbCleaned
+		}
 
-				bvCleaningNow = false
-				continue
-			}
+		bvNbCleaned += bvBatchDelete.Size()
+	}
+}
 
-			if bvResults.Hits.Len() == 0 {
-				bvCleaningNow = false
-				continue
-			}
+// Returns index of the tenant, index that doesn't exist yet is created only if create is true
+func (b *Bleve) getIndex(tenant string, create bool) (index bv.Index, err error) {
+	b.mutexIndices.Lock()
+	defer b.mutexIndices.Unlock()
 
-			// List of documents to be deleted
-			bvBatchDelete = b.index.NewBatch()
-			for _, hit := range bvResults.Hits {
-				bvBatchDelete.Delete(hit.ID)
-			}
+	if index, ok := b.indices[tenant]; ok {
+		return index, nil
+	}
 
-			// Batch delete them
-			err = b.index.Batch(bvBatchDelete)
-			if err != nil {
-				logger.Instance().
-					WithError(err).
-					Warning("Unable to delete obsolete messages from index")
-
-				bvCleaningNow = false
-				continue
-			} else {
-				bvNbCleaned += bvBatchDelete.Size()
-				offset += limit
-			}
+	datapath := b.getIndexPath(tenant)
+
+	if !cli.FileExists(datapath) {
+		if !create {
+			return nil, nil
+		}
+
+		index, err = bv.New(datapath, getIndexMapping())
+
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("tenant", tenant).
+				Error("Unable to create bleve index")
+
+			return nil, err
+		} else {
+			logger.Instance().
+				WithField("tenant", tenant).
+				Debug("New bleve index created")
 		}
+	} else {
+		index, err = bv.Open(datapath)
+
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("tenant", tenant).
+				Error("Unable to open bleve index")
 
-		if bvNbCleaned > 0 {
+			return nil, err
+		} else {
 			logger.Instance().
-				WithField("nb_messages", bvNbCleaned).
-				Infof("Obsolete messages were deleted from index")
+				WithField("tenant", tenant).
+				Debug("Bleve index successfully opened")
 		}
+	}
 
-		time.Sleep(sleepDuration)
+	b.indices[tenant] = index
+
+	return index, nil
+}
+
+// Returns path to the index of the tenant
+func (b *Bleve) getIndexPath(tenant string) string {
+	if len(tenant) == 0 {
+		return b.datapath
+	}
+
+	return b.datapath + "-" + tenant
+}
+
+// Returns copy of opened indices list
+func (b *Bleve) getOpenedIndices() map[string]bv.Index {
+	b.mutexIndices.Lock()
+	defer b.mutexIndices.Unlock()
+
+	result := make(map[string]bv.Index, len(b.indices))
+	for tenant, index := range b.indices {
+		result[tenant] = index
 	}
+
+	return result
+}
+
+// Closes all opened indices
+func (b *Bleve) closeIndices() {
+	b.mutexIndices.Lock()
+	defer b.mutexIndices.Unlock()
+
+	for tenant, index := range b.indices {
+		err := index.Close()
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("tenant", tenant).
+				Warning("Unable to close Bleve index")
+		}
+	}
+
+	b.indices = make(map[string]bv.Index)
+}
+
+// Returns bleve query built from the search query
+func getQuery(q *storage.SearchQuery) bv.Query {
+	conjuncts := []bv.Query{}
+
+	if len(q.Query) > 0 {
+		conjuncts = append(conjuncts, bv.NewQueryStringQuery(q.Query))
+	} else {
+		conjuncts = append(conjuncts, bv.NewMatchAllQuery())
+	}
+
+	if !q.From.IsZero() || !q.To.IsZero() {
+		var from, to *string
+
+		if !q.From.IsZero() {
+			value := q.From.Format(time.RFC3339)
+			from = &value
+		}
+
+		if !q.To.IsZero() {
+			value := q.To.Format(time.RFC3339)
+			to = &value
+		}
+
+		tsRange := bv.NewDateRangeQuery(from, to)
+		tsRange.FieldVal = "timestamp"
+		conjuncts = append(conjuncts, tsRange)
+	}
+
+	if len(q.Hosts) > 0 {
+		conjuncts = append(conjuncts, getPatternsQuery("host", q.Hosts))
+	}
+
+	if len(q.Facilities) > 0 {
+		conjuncts = append(conjuncts, getPatternsQuery("facility", q.Facilities))
+	}
+
+	if level, ok, _ := q.LevelThreshold(); ok {
+		var (
+			max       float64 = float64(level)
+			inclusive bool    = true
+		)
+
+		levelRange := bv.NewNumericRangeInclusiveQuery(nil, &max, nil, &inclusive)
+		levelRange.FieldVal = "level"
+		conjuncts = append(conjuncts, levelRange)
+	}
+
+	return bv.NewConjunctionQuery(conjuncts)
+}
+
+// Returns query that matches messages older than till
+func getTimestampBeforeQuery(till time.Time) bv.Query {
+	value := till.Format(time.RFC3339)
+
+	query := bv.NewDateRangeQuery(nil, &value)
+	query.FieldVal = "timestamp"
+
+	return query
+}
+
+// Returns queries excluding messages of retention policies, nil if there are no policies
+func getRetentionExclusion(policies []*storage.RetentionPolicy) []bv.Query {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	return []bv.Query{getRetentionClassesQuery(storage.RetentionClasses(policies))}
+}
+
+// Returns query that matches messages of retention classes
+func getRetentionClassesQuery(names []string) bv.Query {
+	disjuncts := []bv.Query{}
+
+	for _, name := range names {
+		query := bv.NewTermQuery(name)
+		query.FieldVal = "retention"
+		disjuncts = append(disjuncts, query)
+	}
+
+	return bv.NewDisjunctionQuery(disjuncts)
+}
+
+// Returns query that matches documents which field matches any of the shell-like patterns
+func getPatternsQuery(field string, patterns []string) bv.Query {
+	disjuncts := []bv.Query{}
+
+	for _, pattern := range patterns {
+		query := bv.NewWildcardQuery(pattern)
+		query.FieldVal = field
+		disjuncts = append(disjuncts, query)
+	}
+
+	return bv.NewDisjunctionQuery(disjuncts)
+}
+
+// Restores message from stored fields of the document
+func getMessageFromFields(id string, fields map[string]interface{}) *storage.Message {
+	msg := &storage.Message{
+		Id:    id,
+		Extra: make(map[string]interface{}),
+	}
+
+	for name, value := range fields {
+		str, _ := value.(string)
+		num, _ := value.(float64)
+
+		switch name {
+		case "version":
+			msg.Version = str
+		case "host":
+			msg.Host = str
+		case "short_message":
+			msg.ShortMessage = str
+		case "full_message":
+			msg.FullMessage = str
+		case "timestamp":
+			msg.Timestamp, _ = time.Parse(time.RFC3339, str)
+		case "level":
+			msg.Level = int32(num)
+		case "level_name":
+			msg.LevelName = str
+		case "facility":
+			msg.Facility = str
+		case "file":
+			msg.File = str
+		case "line":
+			msg.Line = int32(num)
+		case "retention":
+			msg.Retention = str
+		default:
+			if strings.HasPrefix(name, "extra.") {
+				msg.Extra[strings.TrimPrefix(name, "extra.")] = value
+			}
+		}
+	}
+
+	// Messages stored before levels got names don't have them
+	if len(msg.LevelName) == 0 {
+		msg.LevelName = storage.LevelName(msg.Level)
+	}
+
+	return msg
 }
 
 // Returns data model for index
@@ -299,11 +839,18 @@ func getIndexMapping() *bv.IndexMapping {
 	messageMapping.AddFieldMappingsAt("full_message", mappingText)
 	messageMapping.AddFieldMappingsAt("timestamp", bv.NewDateTimeFieldMapping())
 	messageMapping.AddFieldMappingsAt("level", bv.NewNumericFieldMapping())
+	messageMapping.AddFieldMappingsAt("level_name", mappingKeyword)
 	messageMapping.AddFieldMappingsAt("facility", mappingKeyword)
+	messageMapping.AddFieldMappingsAt("file", mappingKeyword)
+	messageMapping.AddFieldMappingsAt("line", bv.NewNumericFieldMapping())
+	messageMapping.AddFieldMappingsAt("retention", mappingKeyword)
 	messageMapping.AddSubDocumentMapping("extra", bv.NewDocumentMapping())
 
 	indexMapping.AddDocumentMapping(DOC_TYPE, messageMapping)
 
+	// Messages don't tell their type, so they should use message mapping by default
+	indexMapping.DefaultType = DOC_TYPE
+
 	return indexMapping
 }
 
@@ -317,3 +864,48 @@ func getTextFieldMapping() *bv.FieldMapping {
 		IncludeInAll:       true,
 	}
 }
+
+// Reads new flush, retention and quota settings, returned function applies them
+func (b *Bleve) PrepareReload(c *gc.Config) (func(), error) {
+	settings, err := storage.ReadFlushSettings(c, "bleve")
+	if err != nil {
+		return nil, err
+	}
+
+	tenants, err := storage.NewTenants(c, settings.IntervalCleanup)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := storage.ReadRetentionPolicies(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		b.mutexSettings.Lock()
+		defer b.mutexSettings.Unlock()
+
+		tenants.CarryOver(b.tenants)
+
+		b.settings = settings
+		b.tenants = tenants
+		b.policies = policies
+	}, nil
+}
+
+// Returns current flush settings and tenants registry
+func (b *Bleve) getSettings() (*storage.FlushSettings, *storage.Tenants) {
+	b.mutexSettings.RLock()
+	defer b.mutexSettings.RUnlock()
+
+	return b.settings, b.tenants
+}
+
+// Returns retention policies
+func (b *Bleve) getPolicies() []*storage.RetentionPolicy {
+	b.mutexSettings.RLock()
+	defer b.mutexSettings.RUnlock()
+
+	return b.policies
+}
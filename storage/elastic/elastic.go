@@ -3,35 +3,45 @@ package elastic
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/endeveit/go-gelf/gelf"
-	"github.com/endeveit/go-snippets/config"
-	"github.com/satori/go.uuid"
+	gc "github.com/robfig/config"
 	"golang.org/x/net/context"
 	es "gopkg.in/olivere/elastic.v5"
 	"gopkg.in/olivere/elastic.v5/uritemplates"
 
+	"github.com/endeveit/recause/config"
 	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
 	"github.com/endeveit/recause/storage"
 )
 
 type Elastic struct {
-	batchSize          int
+	settings           *storage.FlushSettings
 	indexName          string
 	typeName           string
 	client             *es.Client
 	mutexHandleMessage *sync.RWMutex
 	mutexFlushMessages *sync.RWMutex
-	ttl                int64
+	mutexSettings      *sync.RWMutex
+	tenants            *storage.Tenants
+	routes             map[string]*storage.IndexRoute
+	policies           []*storage.RetentionPolicy
 	messages           []*storage.Message
-	intervalFlush      time.Duration
 	lastFlush          time.Time
 }
 
+// Maximum time to wait for cluster health response
+const healthTimeout time.Duration = 2 * time.Second
+
+var ErrNotFound error = errors.New("Message not found")
+
 type validateResult struct {
 	Valid bool `json:"valid"`
 }
@@ -79,64 +89,82 @@ func NewElasticStorage() *Elastic {
 		os.Exit(1)
 	}
 
-	batchSize, err := config.Instance().Int("elastic", "batch_size")
-	if err != nil {
-		batchSize = 10
-	}
-
-	var (
-		defaultIntervalSecond string = "1s"
-		defaultIntervalMonth  string = "720h"
-	)
+	// Invalid values are replaced with defaults here, reload rejects them
+	settings, _ := storage.ReadFlushSettings(config.Instance(), "elastic")
 
-	intervalCleanupStr, err := config.Instance().String("elastic", "interval_cleanup")
+	tenants, err := storage.NewTenants(config.Instance(), settings.IntervalCleanup)
 	if err != nil {
-		intervalCleanupStr = defaultIntervalMonth
-	}
+		logger.Instance().
+			WithError(err).
+			Error("Unable to load tenants settings")
 
-	intervalCleanup, err := time.ParseDuration(intervalCleanupStr)
-	if err != nil {
-		intervalCleanup, _ = time.ParseDuration(defaultIntervalMonth)
+		os.Exit(1)
 	}
 
-	intervalFlushStr, err := config.Instance().String("elastic", "interval_flush")
+	routes, err := storage.ReadIndexRoutes(config.Instance())
 	if err != nil {
-		intervalFlushStr = defaultIntervalSecond
+		logger.Instance().
+			WithError(err).
+			Error("Unable to load routes settings")
+
+		os.Exit(1)
 	}
 
-	intervalFlush, err := time.ParseDuration(intervalFlushStr)
+	policies, err := storage.ReadRetentionPolicies(config.Instance())
 	if err != nil {
-		intervalFlush, _ = time.ParseDuration(defaultIntervalSecond)
+		logger.Instance().
+			WithError(err).
+			Error("Unable to load retention policies")
+
+		os.Exit(1)
 	}
 
-	return &Elastic{
-		batchSize:          batchSize,
+	e := &Elastic{
+		settings:           settings,
 		indexName:          indexName,
 		typeName:           typeName,
 		client:             client,
 		messages:           []*storage.Message{},
 		mutexHandleMessage: &sync.RWMutex{},
 		mutexFlushMessages: &sync.RWMutex{},
-		ttl:                int64(intervalCleanup.Seconds() * 1000), // TTL is in milliseconds
-		intervalFlush:      intervalFlush,
+		mutexSettings:      &sync.RWMutex{},
+		tenants:            tenants,
+		routes:             routes,
+		policies:           policies,
 		lastFlush:          time.Now(),
 	}
+
+	config.RegisterReloadable(storage.ReloadableFlushOptions("elastic")...)
+
+	metrics.BufferMessages.Set(func() float64 {
+		e.mutexHandleMessage.RLock()
+		defer e.mutexHandleMessage.RUnlock()
+
+		return float64(len(e.messages))
+	}, "elastic")
+
+	return e
 }
 
-// Returns message from elastic index
-func (e *Elastic) GetMessage(msgId string) (doc map[string]interface{}, err error) {
-	response, err := e.client.
-		Get().
-		Index(e.indexName).
+// Returns message from elastic index, indices of all routes are searched
+func (e *Elastic) GetMessage(tenant, msgId string) (doc map[string]interface{}, err error) {
+	rs, err := e.client.
+		Search(e.getSearchIndices(tenant)...).
 		Type(e.typeName).
-		Id(msgId).
+		IgnoreUnavailable(true).
+		Query(es.NewIdsQuery(e.typeName).Ids(msgId)).
+		Size(1).
 		Do(context.Background())
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(*response.Source, &doc)
+	if rs.Hits == nil || len(rs.Hits.Hits) == 0 {
+		return nil, ErrNotFound
+	}
+
+	err = json.Unmarshal(*rs.Hits.Hits[0].Source, &doc)
 	if err != nil {
 		return nil, err
 	}
@@ -146,39 +174,18 @@ func (e *Elastic) GetMessage(msgId string) (doc map[string]interface{}, err erro
 
 // Searches for mssages
 func (e *Elastic) GetMessages(q *storage.SearchQuery) (result *storage.SearchResult, err error) {
-	var (
-		filters []es.Query    = []es.Query{}
-		query   *es.BoolQuery = es.NewBoolQuery()
-		tsRange *es.RangeQuery
-		msg     *storage.Message
-	)
+	var msg *storage.Message
 
-	if len(q.Query) > 0 {
-		filters = append(filters, es.NewQueryStringQuery(q.Query))
-	} else {
-		filters = append(filters, es.NewMatchAllQuery())
-	}
-
-	if q.From.Second() > 0 && q.To.Second() > 0 {
-		tsRange = es.NewRangeQuery("timestamp")
-		tsRange = tsRange.From(q.From)
-		tsRange = tsRange.To(q.To)
-		filters = append(filters, tsRange)
-	} else if q.From.Second() > 0 && q.To.Second() <= 0 {
-		tsRange = es.NewRangeQuery("timestamp")
-		tsRange = tsRange.From(q.From)
-		filters = append(filters, tsRange)
-	} else if q.To.Second() > 0 && q.From.Second() <= 0 {
-		tsRange = es.NewRangeQuery("timestamp")
-		tsRange = tsRange.To(q.To)
-		filters = append(filters, tsRange)
-	}
+	searchStarted := time.Now()
+	defer metrics.SearchDuration.With("elastic").ObserveSince(searchStarted)
 
 	rs, err := e.client.
-		Search(e.indexName).
+		Search(e.getSearchIndices(q.Tenant)...).
 		Type(e.typeName).
-		Query(query.Filter(filters...)).
-		Sort("timestamp", false).
+		IgnoreUnavailable(true).
+		Query(getQuery(q)).
+		Sort("timestamp", q.Ascending).
+		Sort("_uid", q.Ascending).
 		From(q.Offset).
 		Size(q.Limit).
 		Do(context.Background())
@@ -207,6 +214,11 @@ func (e *Elastic) GetMessages(q *storage.SearchQuery) (result *storage.SearchRes
 
 			msg.Id = hit.Id
 
+			// Messages stored before levels got names don't have them
+			if len(msg.LevelName) == 0 {
+				msg.LevelName = storage.LevelName(msg.Level)
+			}
+
 			result.Messages = append(result.Messages, *msg)
 		}
 	}
@@ -214,59 +226,224 @@ func (e *Elastic) GetMessages(q *storage.SearchQuery) (result *storage.SearchRes
 	return result, nil
 }
 
-// Handles GELF-message received through UDP
-func (e *Elastic) HandleMessage(msg *gelf.Message) {
+// Counts messages matching the query in buckets of the histogram
+func (e *Elastic) GetHistogram(q *storage.SearchQuery, nbBuckets int) (*storage.Histogram, error) {
+	h, err := storage.NewHistogram(q, nbBuckets, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := es.NewDateRangeAggregation().Field("timestamp")
+	for i := range h.Buckets {
+		ranges = ranges.AddRangeWithKey(strconv.Itoa(i), h.Buckets[i].From, h.BucketEnd(i))
+	}
+
+	searchStarted := time.Now()
+	defer metrics.SearchDuration.With("elastic").ObserveSince(searchStarted)
+
+	rs, err := e.client.
+		Search(e.getSearchIndices(q.Tenant)...).
+		Type(e.typeName).
+		IgnoreUnavailable(true).
+		Query(getQuery(q)).
+		Aggregation("histogram", ranges).
+		Size(0).
+		Do(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	items, found := rs.Aggregations.DateRange("histogram")
+	if !found {
+		// Index of the tenant doesn't exist yet
+		return h, nil
+	}
+
+	for _, item := range items.Buckets {
+		i, err := strconv.Atoi(item.Key)
+		if err == nil && i >= 0 && i < len(h.Buckets) {
+			h.Buckets[i].Count = item.DocCount
+		}
+	}
+
+	return h, nil
+}
+
+// Counts messages of every retention class and finds the oldest of them
+func (e *Elastic) GetRetentionStats(q *storage.SearchQuery) ([]*storage.RetentionStats, error) {
+	policies := e.getPolicies()
+	stats := storage.NewRetentionStats(policies)
+
+	for _, item := range stats {
+		var classQuery es.Query
+
+		if item.Name == storage.DEFAULT_RETENTION_CLASS {
+			classQuery = es.NewBoolQuery().MustNot(getRetentionClassesQuery(storage.RetentionClasses(policies)))
+		} else {
+			classQuery = getRetentionClassesQuery([]string{item.Name})
+		}
+
+		rs, err := e.client.
+			Search(e.getSearchIndices(q.Tenant)...).
+			Type(e.typeName).
+			IgnoreUnavailable(true).
+			Query(es.NewBoolQuery().Filter(getQuery(q), classQuery)).
+			Sort("timestamp", true).
+			Size(1).
+			Do(context.Background())
+
+		if err != nil {
+			return nil, err
+		}
+
+		item.Messages = rs.TotalHits()
+
+		if rs.Hits != nil && len(rs.Hits.Hits) > 0 {
+			msg := new(storage.Message)
+			if err = json.Unmarshal(*rs.Hits.Hits[0].Source, msg); err == nil {
+				item.Oldest = &msg.Timestamp
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// Handles message received by one of receivers
+func (e *Elastic) HandleMessage(msg *storage.Message) {
+	_, tenants := e.getSettings()
+
+	if !tenants.Allow(msg.Tenant) {
+		return
+	}
+
+	storage.Live().Publish(msg)
+
 	e.mutexHandleMessage.Lock()
 	defer e.mutexHandleMessage.Unlock()
 
-	e.messages = append(e.messages, storage.NewMessageFromGelf(msg))
+	e.messages = append(e.messages, msg)
+}
+
+// Writes messages immediately bypassing buffer and quotas, identifiers of messages are preserved
+func (e *Elastic) ImportMessages(messages []*storage.Message) error {
+	esBulk := e.client.Bulk()
+
+	for _, message := range messages {
+		if len(message.Id) == 0 {
+			message.Id = storage.MessageId(message)
+		}
+
+		esBulk.Add(es.NewBulkIndexRequest().
+			Index(e.getIndexName(message.Tenant)).
+			Type(e.typeName).
+			Id(message.Id).
+			Doc(message))
+	}
+
+	if esBulk.NumberOfActions() == 0 {
+		return nil
+	}
+
+	esResponse, err := esBulk.Do(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if failed := esResponse.Failed(); len(failed) > 0 {
+		reason := "unknown"
+		if failed[0].Error != nil {
+			reason = failed[0].Error.Reason
+		}
+
+		return fmt.Errorf("%d of %d messages were not imported, first error: %s", len(failed), len(messages), reason)
+	}
+
+	return nil
 }
 
-// Periodically flushes messages to elastic
+// Periodically flushes messages to elastic, buffered messages are flushed before return
 func (e *Elastic) PeriodicFlush(die chan bool) {
 	var (
 		esBulk        *es.BulkService
 		esResponse    *es.BulkResponse
 		err           error
 		nbMessages    int
+		stopping      bool
 		sleepDuration time.Duration = 3 * time.Second
 	)
 
+	// Run periodic cleanup task
+	go e.periodicCleanup(die)
+
 	for {
 		select {
 		case <-die:
-			return
+			stopping = true
 		default:
 		}
 
 		nbMessages = len(e.messages)
+		settings, _ := e.getSettings()
 
-		if nbMessages > 0 && (nbMessages >= e.batchSize || time.Now().Sub(e.lastFlush) > e.intervalFlush) {
+		if nbMessages > 0 && (stopping || nbMessages >= settings.BatchSize || time.Now().Sub(e.lastFlush) > settings.IntervalFlush) {
 			e.mutexFlushMessages.Lock()
 
+			e.mutexHandleMessage.Lock()
+			messages := e.messages
+			e.messages = []*storage.Message{}
+			e.mutexHandleMessage.Unlock()
+
+			nbMessages = len(messages)
 			esBulk = e.client.Bulk()
 
-			for _, message := range e.messages {
+			for _, message := range messages {
+				// Identifier is kept between attempts, so retries don't create duplicates
+				if len(message.Id) == 0 {
+					message.Id = storage.MessageId(message)
+				}
+
 				esBulk.Add(es.NewBulkIndexRequest().
-					Index(e.indexName).
+					Index(e.getMessageIndexName(message)).
 					Type(e.typeName).
-					Id(uuid.NewV4().String()).
+					Id(message.Id).
 					Doc(message))
 			}
 
 			if esBulk.NumberOfActions() > 0 {
+				flushStarted := time.Now()
 				esResponse, err = esBulk.Do(context.Background())
+				metrics.FlushDuration.With("elastic").ObserveSince(flushStarted)
 
 				if err != nil {
 					logger.Instance().
 						WithError(err).
 						Warning("Unable to batch index messages")
+
+					metrics.FlushFailures.With("elastic", "request").Add(float64(nbMessages))
+
+					// Messages will be retried with the next batch
+					e.mutexHandleMessage.Lock()
+					e.messages = append(messages, e.messages...)
+					e.mutexHandleMessage.Unlock()
 				} else {
-					nbCreated := len(esResponse.Indexed())
-					if nbCreated != nbMessages {
+					metrics.FlushBatchSize.With("elastic").Observe(float64(nbMessages))
+
+					failed := esResponse.Failed()
+					for _, item := range failed {
+						reason := "unknown"
+						if item.Error != nil && len(item.Error.Type) > 0 {
+							reason = item.Error.Type
+						}
+
+						metrics.FlushFailures.With("elastic", reason).Inc()
+					}
+
+					if len(failed) > 0 {
 						logger.Instance().
 							WithField("nb_messages", nbMessages).
-							WithField("nb_created", nbCreated).
+							WithField("nb_failed", len(failed)).
 							Warning("Not all messages were indexed")
 					} else {
 						logger.Instance().
@@ -275,21 +452,179 @@ func (e *Elastic) PeriodicFlush(die chan bool) {
 					}
 
 					e.lastFlush = time.Now()
-					e.messages = []*storage.Message{}
 				}
 			}
 
 			e.mutexFlushMessages.Unlock()
 		}
 
+		if stopping {
+			if nbMessages = len(e.messages); nbMessages > 0 {
+				logger.Instance().
+					WithField("nb_messages", nbMessages).
+					Warning("Messages were not flushed before shutdown")
+			}
+
+			return
+		}
+
 		time.Sleep(sleepDuration)
 	}
 }
 
-// Validates search query
-func (e *Elastic) ValidateQuery(query string) (err error) {
+// Checks if elasticsearch cluster is reachable and returns number of buffered messages
+func (e *Elastic) Health() *storage.Health {
+	e.mutexHandleMessage.RLock()
+	buffered := len(e.messages)
+	e.mutexHandleMessage.RUnlock()
+
+	health := &storage.Health{
+		Backend:  "elastic",
+		Buffered: buffered,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	rs, err := e.client.ClusterHealth().Do(ctx)
+	if err != nil {
+		health.Error = err.Error()
+
+		return health
+	}
+
+	health.Details = map[string]interface{}{
+		"cluster_name":    rs.ClusterName,
+		"cluster_status":  rs.Status,
+		"number_of_nodes": rs.NumberOfNodes,
+	}
+
+	// Red cluster is not able to index messages into some shards
+	if rs.Status == "red" {
+		health.Error = "Cluster status is red"
+	} else {
+		health.Reachable = true
+	}
+
+	return health
+}
+
+// Periodically removes messages which are older than retention period of their tenant or route
+func (e *Elastic) periodicCleanup(die chan bool) {
+	sleepDuration := time.Minute
+
+	for {
+		_, tenants := e.getSettings()
+
+		for _, tenant := range tenants.Names() {
+			// Indices of routes without own retention are cleaned up with retention of the tenant
+			retentions := map[string]time.Duration{e.getIndexName(tenant): tenants.Retention(tenant)}
+
+			for _, route := range e.getRoutes() {
+				if route.Retention > 0 {
+					retentions[route.IndexName(tenant)] = route.Retention
+				} else if _, ok := retentions[route.IndexName(tenant)]; !ok {
+					retentions[route.IndexName(tenant)] = tenants.Retention(tenant)
+				}
+			}
+
+			policies := e.getPolicies()
+
+			// Messages of retention policies are removed from all indices according to the policy
+			for index, retention := range retentions {
+				query := es.NewBoolQuery().
+					Filter(es.NewRangeQuery("timestamp").Lt(time.Now().Add(-retention))).
+					MustNot(getRetentionClassesQuery(storage.RetentionClasses(policies)))
+
+				e.cleanupIndices([]string{index}, tenant, query)
+			}
+
+			for _, policy := range policies {
+				query := es.NewBoolQuery().Filter(
+					getRetentionClassesQuery([]string{policy.Name}),
+					es.NewRangeQuery("timestamp").Lt(time.Now().Add(-policy.Period)))
+
+				e.cleanupIndices(e.getSearchIndices(tenant), tenant, query)
+			}
+		}
+
+		select {
+		case <-die:
+			return
+		case <-time.After(sleepDuration):
+		}
+	}
+}
+
+// Removes messages matching the query from indices
+func (e *Elastic) cleanupIndices(indices []string, tenant string, query es.Query) {
+	rs, err := e.client.
+		DeleteByQuery(indices...).
+		Type(e.typeName).
+		IgnoreUnavailable(true).
+		Query(query).
+		Do(context.Background())
+
+	if err != nil {
+		if !es.IsNotFound(err) {
+			logger.Instance().
+				WithError(err).
+				WithField("tenant", tenant).
+				WithField("indices", indices).
+				Warning("Unable to delete obsolete messages from index")
+		}
+
+		return
+	}
+
+	if rs.Deleted > 0 {
+		logger.Instance().
+			WithField("tenant", tenant).
+			WithField("indices", indices).
+			WithField("nb_messages", rs.Deleted).
+			Info("Obsolete messages were deleted from index")
+	}
+}
+
+// Returns name of the index where messages of the tenant are stored
+func (e *Elastic) getIndexName(tenant string) string {
+	if len(tenant) == 0 {
+		return e.indexName
+	}
+
+	return e.indexName + "-" + tenant
+}
+
+// Returns name of the index where message is written according to its route
+func (e *Elastic) getMessageIndexName(msg *storage.Message) string {
+	if route, ok := e.getRoutes()[msg.Route]; ok {
+		return route.IndexName(msg.Tenant)
+	}
+
+	return e.getIndexName(msg.Tenant)
+}
+
+// Returns names of the default index and indices of all routes of the tenant
+func (e *Elastic) getSearchIndices(tenant string) []string {
+	var (
+		indices []string        = []string{e.getIndexName(tenant)}
+		seen    map[string]bool = map[string]bool{indices[0]: true}
+	)
+
+	for _, route := range e.getRoutes() {
+		if index := route.IndexName(tenant); !seen[index] {
+			indices = append(indices, index)
+			seen[index] = true
+		}
+	}
+
+	return indices
+}
+
+// Validates search query against indices of the tenant, indices that don't exist yet are skipped
+func (e *Elastic) ValidateQuery(tenant, query string) (err error) {
 	path, err := uritemplates.Expand("/{index}/{type}/_validate/query", map[string]string{
-		"index": e.indexName,
+		"index": strings.Join(e.getSearchIndices(tenant), ","),
 		"type":  e.typeName,
 	})
 
@@ -299,6 +634,7 @@ func (e *Elastic) ValidateQuery(query string) (err error) {
 
 	params := url.Values{}
 	params.Set("q", query)
+	params.Set("ignore_unavailable", "true")
 
 	rs, err := e.client.PerformRequest(context.Background(), "GET", path, params, nil)
 	if err != nil {
@@ -318,3 +654,130 @@ func (e *Elastic) ValidateQuery(query string) (err error) {
 
 	return nil
 }
+
+// Returns elastic query built from the search query
+func getQuery(q *storage.SearchQuery) es.Query {
+	var (
+		filters []es.Query = []es.Query{}
+		tsRange *es.RangeQuery
+	)
+
+	if len(q.Query) > 0 {
+		filters = append(filters, es.NewQueryStringQuery(q.Query))
+	} else {
+		filters = append(filters, es.NewMatchAllQuery())
+	}
+
+	if !q.From.IsZero() || !q.To.IsZero() {
+		tsRange = es.NewRangeQuery("timestamp")
+
+		if !q.From.IsZero() {
+			tsRange = tsRange.From(q.From)
+		}
+
+		if !q.To.IsZero() {
+			tsRange = tsRange.To(q.To)
+		}
+
+		filters = append(filters, tsRange)
+	}
+
+	if len(q.Hosts) > 0 {
+		filters = append(filters, getPatternsQuery("host", q.Hosts))
+	}
+
+	if len(q.Facilities) > 0 {
+		filters = append(filters, getPatternsQuery("facility", q.Facilities))
+	}
+
+	// Level 0 is not stored, so messages without level are the most severe ones
+	if level, ok, _ := q.LevelThreshold(); ok {
+		filters = append(filters, es.NewBoolQuery().
+			Should(es.NewRangeQuery("level").Lte(level)).
+			Should(es.NewBoolQuery().MustNot(es.NewExistsQuery("level"))).
+			MinimumNumberShouldMatch(1))
+	}
+
+	return es.NewBoolQuery().Filter(filters...)
+}
+
+// Returns query that matches messages of retention classes
+func getRetentionClassesQuery(names []string) es.Query {
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = name
+	}
+
+	return es.NewTermsQuery("retention.keyword", values...)
+}
+
+// Returns query that matches documents which field matches any of the shell-like patterns
+func getPatternsQuery(field string, patterns []string) es.Query {
+	query := es.NewBoolQuery()
+
+	for _, pattern := range patterns {
+		// Dynamic mapping stores not analyzed copy of the string in the «keyword» subfield
+		query = query.Should(es.NewWildcardQuery(field+".keyword", pattern))
+	}
+
+	return query.MinimumNumberShouldMatch(1)
+}
+
+// Reads new flush, retention and quota settings, returned function applies them
+func (e *Elastic) PrepareReload(c *gc.Config) (func(), error) {
+	settings, err := storage.ReadFlushSettings(c, "elastic")
+	if err != nil {
+		return nil, err
+	}
+
+	tenants, err := storage.NewTenants(c, settings.IntervalCleanup)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := storage.ReadIndexRoutes(c)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := storage.ReadRetentionPolicies(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		e.mutexSettings.Lock()
+		defer e.mutexSettings.Unlock()
+
+		tenants.CarryOver(e.tenants)
+
+		e.settings = settings
+		e.tenants = tenants
+		e.routes = routes
+		e.policies = policies
+	}, nil
+}
+
+// Returns current flush settings and tenants registry
+func (e *Elastic) getSettings() (*storage.FlushSettings, *storage.Tenants) {
+	e.mutexSettings.RLock()
+	defer e.mutexSettings.RUnlock()
+
+	return e.settings, e.tenants
+}
+
+// Returns retention policies
+func (e *Elastic) getPolicies() []*storage.RetentionPolicy {
+	e.mutexSettings.RLock()
+	defer e.mutexSettings.RUnlock()
+
+	return e.policies
+}
+
+// Returns index settings of routes
+func (e *Elastic) getRoutes() map[string]*storage.IndexRoute {
+	e.mutexSettings.RLock()
+	defer e.mutexSettings.RUnlock()
+
+	return e.routes
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Returns value of the field. Extra fields are addressed with optional «extra.» prefix
+// and looked up with and without «_» prefix required by GELF
+func (m *Message) Field(name string) (interface{}, bool) {
+	switch name {
+	case "id", "_id":
+		return m.Id, len(m.Id) > 0
+	case "version":
+		return m.Version, len(m.Version) > 0
+	case "host":
+		return m.Host, len(m.Host) > 0
+	case "short_message", "message":
+		return m.ShortMessage, len(m.ShortMessage) > 0
+	case "full_message":
+		return m.FullMessage, len(m.FullMessage) > 0
+	case "timestamp":
+		return m.Timestamp, !m.Timestamp.IsZero()
+	case "level":
+		return m.Level, true
+	case "level_name":
+		return LevelName(m.Level), true
+	case "facility":
+		return m.Facility, len(m.Facility) > 0
+	case "file":
+		return m.File, len(m.File) > 0
+	case "line":
+		return m.Line, m.Line > 0
+	case "tenant":
+		return m.Tenant, len(m.Tenant) > 0
+	}
+
+	key, ok := m.extraKey(name)
+	if !ok {
+		return nil, false
+	}
+
+	return m.Extra[key], true
+}
+
+// Sets value of the field, values of numeric fields are converted from strings, level also accepts names
+func (m *Message) SetField(name string, value interface{}) error {
+	switch name {
+	case "id", "_id", "timestamp", "tenant":
+		return fmt.Errorf("Field «%s» is read-only", name)
+	case "version":
+		m.Version = fmt.Sprint(value)
+	case "host":
+		m.Host = fmt.Sprint(value)
+	case "short_message", "message":
+		m.ShortMessage = fmt.Sprint(value)
+	case "full_message":
+		m.FullMessage = fmt.Sprint(value)
+	case "facility":
+		m.Facility = fmt.Sprint(value)
+	case "file":
+		m.File = fmt.Sprint(value)
+	case "level", "level_name":
+		level, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("Value «%v» of field «%s» is not a level", value, name)
+		}
+
+		m.SetLevel(level)
+	case "line":
+		i, err := strconv.ParseInt(strings.TrimSpace(fmt.Sprint(value)), 10, 32)
+		if err != nil {
+			return fmt.Errorf("Value «%v» of field «%s» is not an integer", value, name)
+		}
+
+		m.Line = int32(i)
+	default:
+		key, ok := m.extraKey(name)
+		if !ok {
+			key = "_" + strings.TrimPrefix(strings.TrimPrefix(name, "extra."), "_")
+		}
+
+		if m.Extra == nil {
+			m.Extra = make(map[string]interface{})
+		}
+
+		m.Extra[key] = value
+	}
+
+	return nil
+}
+
+// Removes the field, fields of GELF message are reset to empty values. Returns false if field didn't exist
+func (m *Message) RemoveField(name string) (bool, error) {
+	if _, ok := m.Field(name); !ok {
+		return false, nil
+	}
+
+	switch name {
+	case "id", "_id", "timestamp", "tenant":
+		return false, fmt.Errorf("Field «%s» is read-only", name)
+	case "level", "level_name":
+		m.Level = 0
+		m.LevelName = ""
+	case "line":
+		m.Line = 0
+	case "version", "host", "short_message", "message", "full_message", "facility", "file":
+		return true, m.SetField(name, "")
+	default:
+		key, _ := m.extraKey(name)
+		delete(m.Extra, key)
+	}
+
+	return true, nil
+}
+
+// Adds tag to the «tags» extra field unless message already has it
+func (m *Message) AddTag(tag string) {
+	var tags []interface{}
+
+	value, _ := m.Field("tags")
+
+	switch existing := value.(type) {
+	case []interface{}:
+		tags = existing
+	case []string:
+		for _, t := range existing {
+			tags = append(tags, t)
+		}
+	case string:
+		tags = append(tags, existing)
+	}
+
+	for _, t := range tags {
+		if t == tag {
+			return
+		}
+	}
+
+	_ = m.SetField("extra.tags", append(tags, tag))
+}
+
+// Returns key of existing extra field
+func (m *Message) extraKey(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "extra.")
+
+	for _, key := range []string{name, "_" + name} {
+		if _, ok := m.Extra[key]; ok {
+			return key, true
+		}
+	}
+
+	return "", false
+}
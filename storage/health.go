@@ -0,0 +1,10 @@
+package storage
+
+// State of the storage backend reported by readiness check
+type Health struct {
+	Backend   string                 `json:"backend"`
+	Reachable bool                   `json:"reachable"`
+	Error     string                 `json:"error,omitempty"`
+	Buffered  int                    `json:"buffered"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// Number of messages received during the interval starting at From
+type HistogramBucket struct {
+	From  time.Time `json:"from"`
+	Count int64     `json:"count"`
+}
+
+type Histogram struct {
+	Interval string            `json:"interval"`
+	Buckets  []HistogramBucket `json:"buckets"`
+}
+
+const MaxHistogramBuckets int = 500
+
+// Intervals of buckets, the smallest one that gives requested number of buckets is used
+var histogramIntervals []time.Duration = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// Returns empty buckets that cover time range of the query. Buckets are aligned to the interval,
+// so their boundaries don't move while the range slides
+func NewHistogram(q *SearchQuery, nbBuckets int, now time.Time) (*Histogram, error) {
+	if q.From.IsZero() {
+		return nil, errors.New("Start of the time range is required for histogram")
+	}
+
+	to := q.To
+	if to.IsZero() {
+		to = now
+	}
+
+	if !to.After(q.From) {
+		return nil, errors.New("End of the time range must be after its start")
+	}
+
+	if nbBuckets <= 0 || nbBuckets > MaxHistogramBuckets {
+		nbBuckets = MaxHistogramBuckets
+	}
+
+	interval := histogramIntervals[len(histogramIntervals)-1]
+	for _, candidate := range histogramIntervals {
+		if to.Sub(q.From)/candidate < time.Duration(nbBuckets) {
+			interval = candidate
+			break
+		}
+	}
+
+	h := &Histogram{
+		Interval: interval.String(),
+		Buckets:  []HistogramBucket{},
+	}
+
+	for from := q.From.Truncate(interval); from.Before(to) && len(h.Buckets) < MaxHistogramBuckets; from = from.Add(interval) {
+		h.Buckets = append(h.Buckets, HistogramBucket{From: from})
+	}
+
+	return h, nil
+}
+
+// Returns end of the bucket with index i
+func (h *Histogram) BucketEnd(i int) time.Time {
+	if i+1 < len(h.Buckets) {
+		return h.Buckets[i+1].From
+	}
+
+	d, _ := time.ParseDuration(h.Interval)
+
+	return h.Buckets[i].From.Add(d)
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Syslog names of levels, index is the level
+var LevelNames []string = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Names used by shippers and logging libraries
+var levelAliases map[string]int32 = map[string]int32{
+	"emerg":         0,
+	"emergency":     0,
+	"panic":         0,
+	"alert":         1,
+	"crit":          2,
+	"critical":      2,
+	"fatal":         2,
+	"err":           3,
+	"error":         3,
+	"severe":        3,
+	"warning":       4,
+	"warn":          4,
+	"notice":        5,
+	"info":          6,
+	"informational": 6,
+	"information":   6,
+	"debug":         7,
+	"trace":         7,
+}
+
+// Converts level name or number to syslog scale. Numbers above 7 are treated as levels of Python logging,
+// e.g. 30 is warning
+func ParseLevel(value interface{}) (int32, error) {
+	var number float64
+
+	switch v := value.(type) {
+	case int32:
+		number = float64(v)
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case float64:
+		number = v
+	case json.Number:
+		return ParseLevel(v.String())
+	case string:
+		name := strings.ToLower(strings.TrimSpace(v))
+		if level, ok := levelAliases[name]; ok {
+			return level, nil
+		}
+
+		var err error
+		if number, err = strconv.ParseFloat(name, 64); err != nil {
+			return 0, fmt.Errorf("Unknown level «%s»", v)
+		}
+	default:
+		return 0, fmt.Errorf("Unknown level «%v»", value)
+	}
+
+	switch {
+	case number < 0:
+		return 0, fmt.Errorf("Unknown level «%v»", value)
+	case number <= 7:
+		return int32(number), nil
+	case number >= 50:
+		return 2, nil
+	case number >= 40:
+		return 3, nil
+	case number >= 30:
+		return 4, nil
+	case number >= 20:
+		return 6, nil
+	}
+
+	return 7, nil
+}
+
+// Returns syslog name of the level, unknown levels are returned as numbers
+func LevelName(level int32) string {
+	if level >= 0 && int(level) < len(LevelNames) {
+		return LevelNames[level]
+	}
+
+	return strconv.Itoa(int(level))
+}
+
+// Sets level and its name
+func (m *Message) SetLevel(level int32) {
+	m.Level = level
+	m.LevelName = LevelName(level)
+}
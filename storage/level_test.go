@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected int32
+		err      bool
+	}{
+		{"emerg", 0, false},
+		{"ALERT", 1, false},
+		{"fatal", 2, false},
+		{" error ", 3, false},
+		{"warn", 4, false},
+		{"notice", 5, false},
+		{"information", 6, false},
+		{"trace", 7, false},
+		{"4", 4, false},
+		{int32(5), 5, false},
+		{3, 3, false},
+		{int64(7), 7, false},
+		{float64(2), 2, false},
+		{json.Number("6"), 6, false},
+		{10, 7, false},
+		{20, 6, false},
+		{30, 4, false},
+		{"40", 3, false},
+		{50, 2, false},
+		{-1, 0, true},
+		{"verbose", 0, true},
+		{"", 0, true},
+		{true, 0, true},
+	}
+
+	for _, test := range tests {
+		actual, err := ParseLevel(test.value)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseLevel(%#v) didn't return error", test.value)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseLevel(%#v) returned error: %v", test.value, err)
+		} else if actual != test.expected {
+			t.Errorf("ParseLevel(%#v) = %d, expected %d", test.value, actual, test.expected)
+		}
+	}
+}
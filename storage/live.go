@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/metrics"
+)
+
+// Recently accepted messages and subscribers that follow new ones, used by live tail
+type LiveStream struct {
+	// Identifier of the process, so clients don't resume using sequence numbers of previous run
+	boot        string
+	buffer      []*LiveMessage
+	next        int
+	seq         uint64
+	subscribers map[*Subscription]bool
+	mutex       *sync.Mutex
+}
+
+// Message with its position in the stream
+type LiveMessage struct {
+	Seq     uint64
+	Message *Message
+}
+
+// Channel of new messages, slow subscriber misses messages instead of blocking receivers
+type Subscription struct {
+	C       chan *LiveMessage
+	stream  *LiveStream
+	dropped int64
+}
+
+const (
+	defaultLiveBuffer int = 1000
+	subscriptionSize  int = 1000
+)
+
+var (
+	onceLive sync.Once
+	live     *LiveStream
+)
+
+// Returns stream of accepted messages, size of the history is set by «[storage] live_buffer»
+func Live() *LiveStream {
+	onceLive.Do(func() {
+		size, err := config.Instance().Int("storage", "live_buffer")
+		if err != nil || size <= 0 {
+			size = defaultLiveBuffer
+		}
+
+		live = NewLiveStream(size)
+	})
+
+	return live
+}
+
+// Returns stream that keeps last size messages
+func NewLiveStream(size int) *LiveStream {
+	return &LiveStream{
+		boot:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer:      make([]*LiveMessage, size),
+		subscribers: make(map[*Subscription]bool),
+		mutex:       &sync.Mutex{},
+	}
+}
+
+// Adds message to the history and sends it to subscribers
+func (ls *LiveStream) Publish(msg *Message) {
+	// Backends modify messages while flushing, so subscribers get a copy
+	copied := *msg
+
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	ls.seq++
+
+	lm := &LiveMessage{Seq: ls.seq, Message: &copied}
+	ls.buffer[ls.next] = lm
+	ls.next = (ls.next + 1) % len(ls.buffer)
+
+	for s := range ls.subscribers {
+		select {
+		case s.C <- lm:
+		default:
+			s.dropped++
+			metrics.MessagesDropped.With("tail", "slow_subscriber").Inc()
+		}
+	}
+}
+
+// Subscribes to new messages. Messages of the history that follow lastId are returned to be sent first,
+// empty lastId means that only new messages are needed
+func (ls *LiveStream) Subscribe(lastId string) (*Subscription, []*LiveMessage) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	s := &Subscription{C: make(chan *LiveMessage, subscriptionSize), stream: ls}
+	ls.subscribers[s] = true
+
+	if len(lastId) == 0 {
+		return s, nil
+	}
+
+	// Identifier of another run means that the whole history is new to the client
+	var after uint64
+
+	if parts := strings.SplitN(lastId, "-", 2); len(parts) == 2 && parts[0] == ls.boot {
+		after, _ = strconv.ParseUint(parts[1], 10, 64)
+	}
+
+	history := []*LiveMessage{}
+	for i := 0; i < len(ls.buffer); i++ {
+		lm := ls.buffer[(ls.next+i)%len(ls.buffer)]
+		if lm != nil && lm.Seq > after {
+			history = append(history, lm)
+		}
+	}
+
+	return s, history
+}
+
+// Returns identifier of the message that client sends back to resume the stream
+func (ls *LiveStream) EventId(lm *LiveMessage) string {
+	return fmt.Sprintf("%s-%d", ls.boot, lm.Seq)
+}
+
+// Stops sending messages to the subscriber
+func (s *Subscription) Close() {
+	s.stream.mutex.Lock()
+	defer s.stream.mutex.Unlock()
+
+	delete(s.stream.subscribers, s)
+}
+
+// Returns number of messages that subscriber missed because it didn't read them in time
+func (s *Subscription) Dropped() int64 {
+	s.stream.mutex.Lock()
+	defer s.stream.mutex.Unlock()
+
+	return s.dropped
+}
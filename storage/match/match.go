@@ -0,0 +1,431 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/endeveit/recause/storage"
+)
+
+// Matcher checks messages against query in memory, so messages can be filtered before they reach storage.
+// Supported syntax is a subset of the query string syntax:
+//
+//	error                      words are searched in short and full messages
+//	"connection refused"       phrases
+//	host:api*                  shell-like patterns applied to the whole field value
+//	level:<=3 line:>100        comparisons of numeric fields
+//	extra.user_id:42           extra fields, «extra.» prefix is optional
+//	a AND b, a OR b, NOT a, -a, (a OR b) c
+//
+// Terms without operator between them must match all.
+type Matcher struct {
+	root node
+}
+
+type node interface {
+	match(msg *storage.Message) bool
+}
+
+// Returns matcher of the query, empty query matches every message
+func Compile(query string) (*Matcher, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return &Matcher{root: matchAll{}}, nil
+	}
+
+	p := &parser{tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected «%s» in query", p.tokens[p.pos].value)
+	}
+
+	return &Matcher{root: root}, nil
+}
+
+// Checks if message matches the query
+func (m *Matcher) Match(msg *storage.Message) bool {
+	return m.root.match(msg)
+}
+
+type matchAll struct{}
+
+func (matchAll) match(*storage.Message) bool {
+	return true
+}
+
+type andNode []node
+
+func (n andNode) match(msg *storage.Message) bool {
+	for _, child := range n {
+		if !child.match(msg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type orNode []node
+
+func (n orNode) match(msg *storage.Message) bool {
+	for _, child := range n {
+		if child.match(msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) match(msg *storage.Message) bool {
+	return !n.child.match(msg)
+}
+
+// Word or phrase searched in the text of the message
+type textNode struct {
+	text string
+}
+
+func (n textNode) match(msg *storage.Message) bool {
+	return containsFold(msg.ShortMessage, n.text) || containsFold(msg.FullMessage, n.text)
+}
+
+// Condition on the field of the message
+type fieldNode struct {
+	field string
+	value string
+	// One of «<», «<=», «>», «>=», empty for equality
+	op     string
+	number float64
+}
+
+func (n fieldNode) match(msg *storage.Message) bool {
+	// Field with list of values, e.g. tags, matches if any of them matches
+	for _, value := range fieldValues(msg, n.field) {
+		if n.matchValue(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n fieldNode) matchValue(value string) bool {
+	if len(n.op) > 0 {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+
+		switch n.op {
+		case "<":
+			return number < n.number
+		case "<=":
+			return number <= n.number
+		case ">":
+			return number > n.number
+		default:
+			return number >= n.number
+		}
+	}
+
+	// Text fields are analyzed by storage, so words inside them are found
+	if n.field == "short_message" || n.field == "full_message" {
+		return containsFold(value, n.value)
+	}
+
+	if ok, err := path.Match(strings.ToLower(n.value), strings.ToLower(value)); err == nil && ok {
+		return true
+	}
+
+	return false
+}
+
+// Returns values of the field as strings, missing field has no values
+func fieldValues(msg *storage.Message, field string) []string {
+	value, ok := msg.Field(field)
+	if !ok {
+		return nil
+	}
+
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			result = append(result, fmt.Sprint(item))
+		}
+
+		return result
+	}
+
+	return []string{fmt.Sprint(value)}
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenPhrase
+	tokenOpen
+	tokenClose
+	tokenNot
+)
+
+type token struct {
+	kind  tokenKind
+	field string
+	value string
+}
+
+// Splits query into terms, phrases, parentheses and negations
+func tokenize(query string) ([]*token, error) {
+	var (
+		result []*token
+		runes  []rune = []rune(query)
+		i      int
+	)
+
+	for i < len(runes) {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			result = append(result, &token{kind: tokenOpen, value: "("})
+			i++
+		case r == ')':
+			result = append(result, &token{kind: tokenClose, value: ")"})
+			i++
+		case (r == '-' || r == '!') && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			result = append(result, &token{kind: tokenNot, value: string(r)})
+			i++
+		case r == '+':
+			i++
+		default:
+			var (
+				field string
+				start int = i
+			)
+
+			// Field name ends with colon, value may be quoted
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != ':' && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+
+			if i < len(runes) && runes[i] == ':' && i > start {
+				field = string(runes[start:i])
+				i++
+				start = i
+			} else {
+				i = start
+			}
+
+			if i < len(runes) && runes[i] == '"' {
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					if runes[end] == '\\' {
+						end++
+					}
+					end++
+				}
+
+				if end >= len(runes) {
+					return nil, errors.New("Unterminated phrase in query")
+				}
+
+				phrase := strings.Replace(string(runes[i+1:end]), `\"`, `"`, -1)
+				result = append(result, &token{kind: tokenPhrase, field: field, value: phrase})
+				i = end + 1
+
+				continue
+			}
+
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+
+			value := string(runes[start:i])
+			if len(value) == 0 {
+				return nil, fmt.Errorf("Value of field «%s» is empty", field)
+			}
+
+			if len(field) == 0 && value == "NOT" {
+				result = append(result, &token{kind: tokenNot, value: value})
+			} else {
+				result = append(result, &token{kind: tokenTerm, field: field, value: value})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+type parser struct {
+	tokens []*token
+	pos    int
+}
+
+func (p *parser) peekOperator(name string) bool {
+	return p.pos < len(p.tokens) &&
+		p.tokens[p.pos].kind == tokenTerm &&
+		len(p.tokens[p.pos].field) == 0 &&
+		p.tokens[p.pos].value == name
+}
+
+func (p *parser) parseOr() (node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	result := orNode{first}
+
+	for p.peekOperator("OR") {
+		p.pos++
+
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, next)
+	}
+
+	if len(result) == 1 {
+		return first, nil
+	}
+
+	return result, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	result := andNode{}
+
+	for p.pos < len(p.tokens) {
+		if p.peekOperator("OR") || p.tokens[p.pos].kind == tokenClose {
+			break
+		}
+
+		if p.peekOperator("AND") {
+			p.pos++
+
+			// Both sides of the operator are required, «a AND» is a mistake rather than «a»
+			if len(result) == 0 || p.pos >= len(p.tokens) || p.peekOperator("AND") || p.peekOperator("OR") ||
+				p.tokens[p.pos].kind == tokenClose {
+				return nil, errors.New("Operator without operand in query")
+			}
+
+			continue
+		}
+
+		next, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, next)
+	}
+
+	switch len(result) {
+	case 0:
+		return nil, errors.New("Operator without operand in query")
+	case 1:
+		return result[0], nil
+	}
+
+	return result, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.tokens[p.pos].kind == tokenNot {
+		p.pos++
+
+		if p.pos >= len(p.tokens) {
+			return nil, errors.New("Negation without operand in query")
+		}
+
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{child: child}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case tokenOpen:
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenClose {
+			return nil, errors.New("Unbalanced parentheses in query")
+		}
+
+		p.pos++
+
+		return result, nil
+	case tokenPhrase:
+		if len(t.field) == 0 {
+			return textNode{text: t.value}, nil
+		}
+
+		return fieldNode{field: t.field, value: t.value}, nil
+	case tokenTerm:
+		if len(t.field) == 0 {
+			return textNode{text: t.value}, nil
+		}
+
+		return newFieldNode(t.field, t.value)
+	}
+
+	return nil, fmt.Errorf("Unexpected «%s» in query", t.value)
+}
+
+// Returns condition on field, value may start with comparison operator
+func newFieldNode(field, value string) (node, error) {
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(value, op) {
+			number, err := strconv.ParseFloat(value[len(op):], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Value «%s» of field «%s» is not a number", value[len(op):], field)
+			}
+
+			return fieldNode{field: field, op: op, number: number}, nil
+		}
+	}
+
+	return fieldNode{field: field, value: value}, nil
+}
@@ -0,0 +1,98 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/endeveit/recause/storage"
+)
+
+func testMessage() *storage.Message {
+	return &storage.Message{
+		Host:         "api-01",
+		ShortMessage: "Connection refused by upstream",
+		FullMessage:  "dial tcp 10.0.0.1:5432: connection refused",
+		Level:        3,
+		Facility:     "billing",
+		Line:         120,
+		Extra: map[string]interface{}{
+			"_user_id": 42,
+			"_tags":    []interface{}{"db", "retry"},
+		},
+	}
+}
+
+func TestCompileMatch(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"", true},
+		{"refused", true},
+		{"REFUSED", true},
+		{"timeout", false},
+		{`"connection refused"`, true},
+		{`"refused connection"`, false},
+		{"host:api*", true},
+		{"host:web*", false},
+		{"host:API-01", true},
+		{"level:<=3", true},
+		{"level:<3", false},
+		{"line:>100", true},
+		{"line:>=121", false},
+		{"extra.user_id:42", true},
+		{"user_id:42", true},
+		{"user_id:43", false},
+		{"tags:retry", true},
+		{"tags:cache", false},
+		{"missing:*", false},
+		{"short_message:upstream", true},
+		{"refused timeout", false},
+		{"refused AND timeout", false},
+		{"refused OR timeout", true},
+		{"NOT timeout", true},
+		{"-timeout", true},
+		{"!refused", false},
+		{"-host:api*", false},
+		{"(timeout OR refused) facility:billing", true},
+		{"(timeout OR refused) facility:auth", false},
+		{"timeout OR (refused AND NOT host:web*)", true},
+		{"+refused", true},
+	}
+
+	msg := testMessage()
+
+	for _, test := range tests {
+		m, err := Compile(test.query)
+		if err != nil {
+			t.Errorf("Compile(%q) returned error: %v", test.query, err)
+
+			continue
+		}
+
+		if actual := m.Match(msg); actual != test.expected {
+			t.Errorf("Compile(%q).Match() = %v, expected %v", test.query, actual, test.expected)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		`"unterminated`,
+		"host:",
+		"(refused",
+		"refused)",
+		"refused AND",
+		"AND refused",
+		"refused AND OR timeout",
+		"(refused AND)",
+		"OR refused",
+		"NOT",
+		"level:>abc",
+	}
+
+	for _, query := range tests {
+		if _, err := Compile(query); err == nil {
+			t.Errorf("Compile(%q) didn't return error", query)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package storage
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/endeveit/go-gelf/gelf"
@@ -19,20 +24,68 @@ type Message struct {
 	File         string                 `json:"file,omitempty"`
 	Line         int32                  `json:"line,omitempty"`
 	Extra        map[string]interface{} `json:"extra,omitempty"`
+	Tenant       string                 `json:"tenant,omitempty"`
+	// Syslog name of the level
+	LevelName string `json:"level_name,omitempty"`
+	// Retention policy of the message, empty means retention of the tenant or the route
+	Retention string `json:"retention,omitempty"`
+	// Name of the route chosen by the router, it defines the index message is written to
+	Route string `json:"-"`
+	// IP address of the client that sent the message, it isn't known for imported messages
+	Sender string `json:"-"`
 }
 
 // Returns custom message based on GELF message structure
 func NewMessageFromGelf(msg *gelf.Message) *Message {
-	return &Message{
+	m := &Message{
 		Version:      msg.Version,
 		Host:         msg.Host,
 		ShortMessage: msg.Short,
 		FullMessage:  msg.Full,
-		Timestamp:    time.Unix(int64(msg.TimeUnix), 0),
-		Level:        msg.Level,
 		Facility:     msg.Facility,
 		File:         msg.File,
 		Line:         msg.Line,
 		Extra:        msg.Extra,
 	}
+
+	// Timestamp is optional, without it identical messages would get the same identifier and replace each other
+	if msg.TimeUnix == 0 {
+		m.Timestamp = time.Now().Round(time.Microsecond)
+	} else {
+		m.Timestamp = timeFromUnix(msg.TimeUnix)
+	}
+
+	// Some shippers send levels of Python logging
+	level, err := ParseLevel(msg.Level)
+	if err != nil {
+		level = msg.Level
+	}
+
+	m.SetLevel(level)
+
+	return m
+}
+
+// Converts GELF timestamp keeping fractional seconds, so identical messages sent within a second get different identifiers
+func timeFromUnix(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+
+	return time.Unix(int64(sec), int64(frac*1e9)).Round(time.Microsecond)
+}
+
+// Returns identifier derived from the content of the message, so the same message sent again
+// by retrying shipper or redundant relay replaces the stored one instead of being duplicated
+func MessageId(msg *Message) string {
+	h := sha1.New()
+
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00%s\x00%d\x00%s\x00%s\x00%d\x00",
+		msg.Tenant, msg.Timestamp.UnixNano(), msg.Host, msg.ShortMessage, msg.FullMessage,
+		msg.Level, msg.Facility, msg.File, msg.Line)
+
+	// Keys of maps are sorted by encoder, so extra fields give the same hash in any order
+	if len(msg.Extra) > 0 {
+		_ = json.NewEncoder(h).Encode(msg.Extra)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
 }
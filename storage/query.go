@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/endeveit/recause/config"
+)
+
+// Parses relative time range like «last 15m», «2h» or «7d» and returns its duration
+func ParseRelativeRange(value string) (time.Duration, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	value = strings.TrimSpace(strings.TrimPrefix(value, "last"))
+	value = strings.TrimPrefix(value, "-")
+
+	if len(value) == 0 {
+		return 0, errors.New("Relative time range is empty")
+	}
+
+	d, err := config.ParsePeriod(value)
+	if err != nil {
+		return 0, errors.New("Invalid relative time range: " + value)
+	}
+
+	return d, nil
+}
+
+// Returns the greatest level number matching «min_level» of the query, false if the query doesn't restrict levels
+func (q *SearchQuery) LevelThreshold() (int32, bool, error) {
+	if len(q.MinLevel) == 0 {
+		return 0, false, nil
+	}
+
+	level, err := ParseLevel(q.MinLevel)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return level, true, nil
+}
+
+// Converts relative time range of the query to the absolute one
+func (q *SearchQuery) ResolveRange(now time.Time) error {
+	if len(q.Range) == 0 {
+		return nil
+	}
+
+	d, err := ParseRelativeRange(q.Range)
+	if err != nil {
+		return err
+	}
+
+	q.From = now.Add(-d)
+	q.To = time.Time{}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRelativeRange(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{"last 15m", 15 * time.Minute, false},
+		{"Last 1h30m", 90 * time.Minute, false},
+		{"2h", 2 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"-3d", 3 * 24 * time.Hour, false},
+		{"", 0, true},
+		{"last", 0, true},
+		{"0s", 0, true},
+		{"0d", 0, true},
+		{"abc", 0, true},
+		{"1.5d", 0, true},
+	}
+
+	for _, test := range tests {
+		actual, err := ParseRelativeRange(test.value)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseRelativeRange(%q) didn't return error", test.value)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseRelativeRange(%q) returned error: %v", test.value, err)
+		} else if actual != test.expected {
+			t.Errorf("ParseRelativeRange(%q) = %v, expected %v", test.value, actual, test.expected)
+		}
+	}
+}
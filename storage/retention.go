@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+)
+
+// Retention policy described in «retention:<name>» section of the config
+type RetentionPolicy struct {
+	Name   string
+	Period time.Duration
+}
+
+// Number of messages and the oldest message of the retention class
+type RetentionStats struct {
+	Name string `json:"name"`
+	// Empty period means retention of the tenant or the route
+	Period   string     `json:"period,omitempty"`
+	Messages int64      `json:"messages"`
+	Oldest   *time.Time `json:"oldest,omitempty"`
+}
+
+const RETENTION_SECTION_PREFIX string = "retention:"
+
+// Class of messages that don't match any policy, they are kept according to retention of their tenant or route
+const DEFAULT_RETENTION_CLASS string = "default"
+
+// Returns policies listed in «[retention] policies»
+func ReadRetentionPolicies(c *gc.Config) ([]*RetentionPolicy, error) {
+	var (
+		policies []*RetentionPolicy
+		value, _ = c.String("retention", "policies")
+	)
+
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+
+		if name == DEFAULT_RETENTION_CLASS {
+			return nil, fmt.Errorf("Retention policy can't be named «%s»", DEFAULT_RETENTION_CLASS)
+		}
+
+		if err := ValidateTenantName(name); err != nil {
+			return nil, fmt.Errorf("Invalid retention policy name «%s»", name)
+		}
+
+		period, err := c.String(RETENTION_SECTION_PREFIX+name, "period")
+		if err != nil || len(strings.TrimSpace(period)) == 0 {
+			return nil, fmt.Errorf("Retention policy «%s» doesn't have period", name)
+		}
+
+		policy := &RetentionPolicy{Name: name}
+
+		// Periods like «3d» are allowed in addition to Go durations
+		if policy.Period, err = config.ParsePeriod(period); err != nil {
+			return nil, fmt.Errorf("Invalid period of retention policy «%s»", name)
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// Returns names of policies
+func RetentionClasses(policies []*RetentionPolicy) []string {
+	names := []string{}
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+	}
+
+	return names
+}
+
+// Returns stats of the default class followed by stats of policies with empty counters
+func NewRetentionStats(policies []*RetentionPolicy) []*RetentionStats {
+	stats := []*RetentionStats{{Name: DEFAULT_RETENTION_CLASS}}
+
+	for _, policy := range policies {
+		stats = append(stats, &RetentionStats{Name: policy.Name, Period: formatPeriod(policy.Period)})
+	}
+
+	return stats
+}
+
+// Returns period in days when possible, e.g. «3d» instead of «72h0m0s»
+func formatPeriod(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+
+	return d.String()
+}
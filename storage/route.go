@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+)
+
+// Index settings of the route described in «route:<name>» section of the config
+type IndexRoute struct {
+	Name string
+	// Template of the index name, «%{tenant}» is replaced with the tenant of the message.
+	// Tenant is appended to names without the placeholder like it is done for the default index
+	Index string
+	// Retention of messages in the index, zero means retention of the tenant
+	Retention time.Duration
+}
+
+const ROUTE_SECTION_PREFIX string = "route:"
+
+// Index names must be lowercase and can't contain special characters
+var reIndexName *regexp.Regexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-.]*$`)
+
+// Returns routes that have own index by route names
+func ReadIndexRoutes(c *gc.Config) (map[string]*IndexRoute, error) {
+	routes := make(map[string]*IndexRoute)
+
+	for _, section := range c.Sections() {
+		if !strings.HasPrefix(section, ROUTE_SECTION_PREFIX) {
+			continue
+		}
+
+		route := &IndexRoute{Name: strings.TrimPrefix(section, ROUTE_SECTION_PREFIX)}
+
+		if index, err := c.String(section, "index"); err == nil {
+			route.Index = strings.TrimSpace(index)
+		}
+
+		if retentionStr, err := c.String(section, "retention"); err == nil && len(retentionStr) > 0 {
+			route.Retention, err = config.ParsePeriod(retentionStr)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid retention of route «%s»", route.Name)
+			}
+		}
+
+		if len(route.Index) == 0 {
+			if route.Retention > 0 {
+				return nil, fmt.Errorf("Route «%s» has retention, but doesn't have own index", route.Name)
+			}
+
+			continue
+		}
+
+		if !reIndexName.MatchString(strings.Replace(route.Index, "%{tenant}", "x", -1)) {
+			return nil, fmt.Errorf("Invalid index name «%s» of route «%s»", route.Index, route.Name)
+		}
+
+		routes[route.Name] = route
+	}
+
+	return routes, nil
+}
+
+// Returns name of the index where messages of the tenant are stored
+func (r *IndexRoute) IndexName(tenant string) string {
+	if !strings.Contains(r.Index, "%{tenant}") {
+		if len(tenant) == 0 {
+			return r.Index
+		}
+
+		return r.Index + "-" + tenant
+	}
+
+	// Separator next to the placeholder is removed together with it
+	if len(tenant) == 0 {
+		return strings.NewReplacer("-%{tenant}", "", "_%{tenant}", "", "%{tenant}-", "", "%{tenant}", "").Replace(r.Index)
+	}
+
+	return strings.Replace(r.Index, "%{tenant}", tenant, -1)
+}
@@ -0,0 +1,201 @@
+package saved
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/satori/go.uuid"
+
+	"github.com/endeveit/recause/storage"
+)
+
+// Named search query shared between users of the tenant
+type Search struct {
+	Id          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Owner       string              `json:"owner,omitempty"`
+	Tenant      string              `json:"tenant,omitempty"`
+	Query       storage.SearchQuery `json:"query"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// Structure that used to persist saved searches in embedded bolt database
+type Store struct {
+	db *bolt.DB
+}
+
+var (
+	bucketName []byte = []byte("searches")
+
+	ErrNotFound error = errors.New("Saved search not found")
+)
+
+// Returns object to work with saved searches stored in the file
+func NewStore(datapath string) (*Store, error) {
+	db, err := bolt.Open(datapath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Validates saved search before storing it
+func (s *Search) Validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if len(s.Name) == 0 {
+		return errors.New("Name of the saved search is empty")
+	}
+
+	if len(s.Tenant) == 0 {
+		s.Tenant = storage.DefaultTenant()
+	} else if err := storage.ValidateTenantName(s.Tenant); err != nil {
+		return err
+	}
+
+	if len(s.Query.Range) > 0 {
+		if _, err := storage.ParseRelativeRange(s.Query.Range); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks if the search is available to users of the tenant
+func (s *Search) BelongsTo(tenant string) bool {
+	if len(s.Tenant) == 0 {
+		return tenant == storage.DefaultTenant()
+	}
+
+	return s.Tenant == tenant
+}
+
+// Returns saved searches of the tenant ordered by name, empty tenant means searches of all tenants
+func (st *Store) List(tenant string) (searches []*Search, err error) {
+	searches = []*Search{}
+
+	err = st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(k, v []byte) error {
+			s := new(Search)
+			if err := json.Unmarshal(v, s); err != nil {
+				return err
+			}
+
+			if len(tenant) == 0 || s.BelongsTo(tenant) {
+				searches = append(searches, s)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(byName(searches))
+
+	return searches, nil
+}
+
+// Returns saved search by its identifier, searches of other tenants aren't found. Empty tenant means any tenant
+func (st *Store) Get(id, tenant string) (s *Search, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketName).Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		s = new(Search)
+
+		return json.Unmarshal(v, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tenant) > 0 && !s.BelongsTo(tenant) {
+		return nil, ErrNotFound
+	}
+
+	return s, nil
+}
+
+// Creates new saved search or replaces the existing one
+func (st *Store) Save(s *Search) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	return st.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+
+		if len(s.Id) == 0 {
+			s.Id = uuid.NewV4().String()
+			s.CreatedAt = now
+		} else {
+			v := bucket.Get([]byte(s.Id))
+			if v == nil {
+				return ErrNotFound
+			}
+
+			existing := new(Search)
+			if err := json.Unmarshal(v, existing); err != nil {
+				return err
+			}
+
+			s.CreatedAt = existing.CreatedAt
+		}
+
+		s.UpdatedAt = now
+
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(s.Id), b)
+	})
+}
+
+// Removes saved search
+func (st *Store) Delete(id string) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// Closes underlying database
+func (st *Store) Close() error {
+	return st.db.Close()
+}
+
+type byName []*Search
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+)
+
+// Settings of the messages buffer that may be changed without restart
+type FlushSettings struct {
+	// Number of messages that triggers flush
+	BatchSize int
+	// Maximum time messages are kept in buffer
+	IntervalFlush time.Duration
+	// Retention of messages of tenants without own settings
+	IntervalCleanup time.Duration
+}
+
+const (
+	defaultBatchSize       int    = 10
+	defaultIntervalFlush   string = "1s"
+	defaultIntervalCleanup string = "720h"
+)
+
+// Reads flush settings from the section of the config.
+// Defaults are used instead of missing or invalid values, error describes the first invalid value
+func ReadFlushSettings(c *gc.Config, section string) (*FlushSettings, error) {
+	var (
+		result   *FlushSettings = &FlushSettings{BatchSize: defaultBatchSize}
+		firstErr error
+	)
+
+	if c.HasOption(section, "batch_size") {
+		batchSize, err := c.Int(section, "batch_size")
+		if err != nil || batchSize <= 0 {
+			firstErr = fmt.Errorf("Option «%s.batch_size» must be positive integer", section)
+		} else {
+			result.BatchSize = batchSize
+		}
+	}
+
+	readDuration := func(option, defaultValue string, parse func(string) (time.Duration, error)) time.Duration {
+		defaultDuration, _ := time.ParseDuration(defaultValue)
+
+		value, err := c.String(section, option)
+		if err != nil || len(value) == 0 {
+			return defaultDuration
+		}
+
+		duration, err := parse(value)
+		if err != nil || duration <= 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("Option «%s.%s» must be positive duration, e.g. «%s»", section, option, defaultValue)
+			}
+
+			return defaultDuration
+		}
+
+		return duration
+	}
+
+	result.IntervalFlush = readDuration("interval_flush", defaultIntervalFlush, time.ParseDuration)
+	// Retention of the backend accepts days and weeks like other retention settings
+	result.IntervalCleanup = readDuration("interval_cleanup", defaultIntervalCleanup, config.ParsePeriod)
+
+	return result, firstErr
+}
+
+// Returns options of the section which changes are applied by backend without restart
+func ReloadableFlushOptions(section string) []string {
+	return []string{
+		section + ".batch_size",
+		section + ".interval_flush",
+		section + ".interval_cleanup",
+		TENANT_SECTION_PREFIX + "*.retention",
+		TENANT_SECTION_PREFIX + "*.quota",
+	}
+}
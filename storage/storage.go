@@ -2,8 +2,6 @@ package storage
 
 import (
 	"time"
-
-	"github.com/endeveit/go-gelf/gelf"
 )
 
 type SearchQuery struct {
@@ -12,6 +10,17 @@ type SearchQuery struct {
 	Offset int       `json:"offset,omitempty"`
 	From   time.Time `json:"from,omitempty"`
 	To     time.Time `json:"to,omitempty"`
+	// Relative time range, e.g. «last 15m», overrides From and To when set
+	Range string `json:"range,omitempty"`
+	// Tenant which messages are searched, server overrides it for tokens bound to the tenant
+	Tenant string `json:"tenant,omitempty"`
+	// The least severe level of messages, e.g. «warning» finds warnings, errors and more severe messages
+	MinLevel string `json:"min_level,omitempty"`
+	// Shell-like patterns injected by the server to restrict the results, e.g. for limited API tokens
+	Hosts      []string `json:"-"`
+	Facilities []string `json:"-"`
+	// Oldest messages first, used by export to walk through the index
+	Ascending bool `json:"-"`
 }
 
 type SearchResult struct {
@@ -23,9 +32,13 @@ type SearchResult struct {
 }
 
 type Storage interface {
-	GetMessage(string) (map[string]interface{}, error)
+	GetMessage(string, string) (map[string]interface{}, error)
 	GetMessages(*SearchQuery) (*SearchResult, error)
-	HandleMessage(*gelf.Message)
+	GetHistogram(*SearchQuery, int) (*Histogram, error)
+	GetRetentionStats(*SearchQuery) ([]*RetentionStats, error)
+	HandleMessage(*Message)
+	Health() *Health
+	ImportMessages([]*Message) error
 	PeriodicFlush(chan bool)
-	ValidateQuery(string) error
+	ValidateQuery(string, string) error
 }
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gc "github.com/robfig/config"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
+)
+
+// Settings of the tenant described in «tenant:<name>» section of the config
+type TenantSettings struct {
+	Retention time.Duration
+	// Maximum number of messages accepted per day, zero means unlimited
+	Quota int64
+}
+
+// Structure that keeps settings of all tenants and counts messages to enforce quotas
+type Tenants struct {
+	defaultRetention time.Duration
+	settings         map[string]*TenantSettings
+	counters         map[string]int64
+	seen             map[string]bool
+	day              string
+	mutex            *sync.Mutex
+}
+
+const TENANT_SECTION_PREFIX string = "tenant:"
+
+var (
+	// Tenant name is used in index names and paths, so only safe characters are allowed
+	reTenantName *regexp.Regexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-]*$`)
+
+	onceDefaultTenant sync.Once
+	defaultTenant     string
+)
+
+// Returns tenant of messages and queries that have no tenant, empty string means single-tenant mode.
+// Value is read once because changing it requires restart
+func DefaultTenant() string {
+	onceDefaultTenant.Do(func() {
+		tenant, err := config.Instance().String("tenants", "default")
+		if err == nil {
+			defaultTenant = strings.TrimSpace(tenant)
+		}
+	})
+
+	return defaultTenant
+}
+
+// Checks if name may be used as tenant name
+func ValidateTenantName(name string) error {
+	if len(name) > 0 && !reTenantName.MatchString(name) {
+		return fmt.Errorf("Invalid tenant name «%s», only lowercase letters, digits, «_» and «-» are allowed", name)
+	}
+
+	return nil
+}
+
+// Returns tenants registry read from the config, retention of tenants without own settings equals to defaultRetention
+func NewTenants(c *gc.Config, defaultRetention time.Duration) (*Tenants, error) {
+	t := &Tenants{
+		defaultRetention: defaultRetention,
+		settings:         make(map[string]*TenantSettings),
+		counters:         make(map[string]int64),
+		seen:             make(map[string]bool),
+		mutex:            &sync.Mutex{},
+	}
+
+	if err := ValidateTenantName(DefaultTenant()); err != nil {
+		return nil, err
+	}
+
+	t.seen[DefaultTenant()] = true
+
+	for _, section := range c.Sections() {
+		if !strings.HasPrefix(section, TENANT_SECTION_PREFIX) {
+			continue
+		}
+
+		name := strings.TrimPrefix(section, TENANT_SECTION_PREFIX)
+		if err := ValidateTenantName(name); err != nil || len(name) == 0 {
+			return nil, fmt.Errorf("Invalid tenant name in section «%s»", section)
+		}
+
+		settings := &TenantSettings{Retention: defaultRetention}
+
+		if retentionStr, err := c.String(section, "retention"); err == nil && len(retentionStr) > 0 {
+			settings.Retention, err = config.ParsePeriod(retentionStr)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid retention of tenant «%s»: %v", name, err)
+			}
+		}
+
+		if quota, err := c.Int(section, "quota"); err == nil && quota > 0 {
+			settings.Quota = int64(quota)
+		}
+
+		t.settings[name] = settings
+		t.seen[name] = true
+	}
+
+	return t, nil
+}
+
+// Takes over message counters from the registry that is replaced on config reload, so quotas aren't reset
+func (t *Tenants) CarryOver(old *Tenants) {
+	old.mutex.Lock()
+	defer old.mutex.Unlock()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.day = old.day
+
+	for name, counter := range old.counters {
+		t.counters[name] = counter
+	}
+
+	for name := range old.seen {
+		t.seen[name] = true
+	}
+}
+
+// Returns retention period of the tenant
+func (t *Tenants) Retention(tenant string) time.Duration {
+	if settings, ok := t.settings[tenant]; ok {
+		return settings.Retention
+	}
+
+	return t.defaultRetention
+}
+
+// Counts message of the tenant and checks if it fits into the daily quota
+func (t *Tenants) Allow(tenant string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.seen[tenant] = true
+
+	day := time.Now().UTC().Format("2006-01-02")
+	if day != t.day {
+		t.day = day
+		t.counters = make(map[string]int64)
+	}
+
+	t.counters[tenant]++
+
+	settings, ok := t.settings[tenant]
+	if !ok || settings.Quota == 0 || t.counters[tenant] <= settings.Quota {
+		return true
+	}
+
+	metrics.MessagesDropped.With("all", "quota").Inc()
+
+	// Log only once to avoid flooding
+	if t.counters[tenant] == settings.Quota+1 {
+		logger.Instance().
+			WithField("tenant", tenant).
+			WithField("quota", settings.Quota).
+			Warning("Daily quota of the tenant is exceeded, messages will be dropped till the end of the day")
+	}
+
+	return false
+}
+
+// Returns names of configured tenants and tenants that sent messages
+func (t *Tenants) Names() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	names := []string{}
+	for name := range t.seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
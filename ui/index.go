@@ -0,0 +1,68 @@
+package ui
+
+const indexHtml string = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>reCause</title>
+<link rel="stylesheet" href="app.css">
+</head>
+<body>
+<header>
+  <form id="search" autocomplete="off">
+    <input id="query" type="search" placeholder="Query, e.g. level:&lt;=3 host:api*" spellcheck="false">
+    <select id="range" title="Time range">
+      <option value="15m">Last 15 minutes</option>
+      <option value="1h" selected>Last hour</option>
+      <option value="6h">Last 6 hours</option>
+      <option value="24h">Last 24 hours</option>
+      <option value="7d">Last 7 days</option>
+      <option value="30d">Last 30 days</option>
+      <option value="custom">Custom range</option>
+    </select>
+    <select id="level" title="Minimum level">
+      <option value="">All levels</option>
+      <option value="err">Errors</option>
+      <option value="warning">Warnings and errors</option>
+      <option value="notice">Notices and above</option>
+      <option value="info">Info and above</option>
+    </select>
+    <span id="custom" hidden>
+      <input id="from" type="datetime-local" step="1" title="From">
+      <input id="to" type="datetime-local" step="1" title="To, leave empty for now">
+    </span>
+    <button type="submit">Search</button>
+    <label class="toggle" title="Follow new messages matching the query"><input id="tail" type="checkbox"> Live</label>
+    <button type="button" id="help-toggle" title="Query syntax">?</button>
+    <button type="button" id="settings-toggle" title="Token and tenant">&#9881;</button>
+  </form>
+  <div id="settings" class="panel" hidden>
+    <label>API token <input id="token" type="password" placeholder="Stored in this browser only"></label>
+    <label>Tenant <input id="tenant" placeholder="Default tenant"></label>
+  </div>
+  <div id="help" class="panel" hidden>
+    <table>
+      <tr><td><code>timeout</code></td><td>word in short or full message</td></tr>
+      <tr><td><code>"connection refused"</code></td><td>phrase</td></tr>
+      <tr><td><code>host:api*</code></td><td>field matching pattern, fields: host, facility, file, line, level, short_message, full_message</td></tr>
+      <tr><td><code>level:&lt;=3</code></td><td>numeric comparison: &lt;, &lt;=, &gt;, &gt;=</td></tr>
+      <tr><td><code>extra.user_id:42</code></td><td>extra field</td></tr>
+      <tr><td><code>+error -debug</code></td><td>required and excluded terms</td></tr>
+      <tr><td><code>(a OR b) AND NOT c</code></td><td>boolean operators, supported by elastic backend and live tail</td></tr>
+    </table>
+    <p>Click a bar of the histogram to zoom into its interval. Address of the page is a permalink to the current search.</p>
+  </div>
+</header>
+<div id="histogram" title="Messages per interval"></div>
+<div id="status" role="status"></div>
+<ol id="results"></ol>
+<nav id="pager">
+  <button type="button" id="newer">&larr; Newer</button>
+  <span id="page"></span>
+  <button type="button" id="older">Older &rarr;</button>
+</nav>
+<script src="app.js"></script>
+</body>
+</html>
+`
@@ -0,0 +1,441 @@
+package ui
+
+// Script doesn't use template literals, so it fits into Go raw string
+const appJs string = `(function () {
+  'use strict';
+
+  var PAGE_SIZE = 100;
+  var HISTOGRAM_BUCKETS = 120;
+  var TAIL_LIMIT = 500;
+  var TAIL_RETRY = 3000;
+  var LEVELS = ['emerg', 'alert', 'crit', 'error', 'warning', 'notice', 'info', 'debug'];
+
+  var $ = function (id) { return document.getElementById(id); };
+
+  var state = { query: '', range: '1h', from: '', to: '', level: '', tenant: '', offset: 0, tail: false };
+  var total = 0;
+  var tail = null;
+  var searchSeq = 0;
+
+  // Creates element with text content, data is never inserted as HTML
+  function el(tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) { node.className = className; }
+    if (text !== undefined && text !== null) { node.textContent = String(text); }
+    return node;
+  }
+
+  function pad(n, width) {
+    var s = String(n);
+    while (s.length < (width || 2)) { s = '0' + s; }
+    return s;
+  }
+
+  function formatTime(value) {
+    var d = new Date(value);
+    if (isNaN(d.getTime())) { return String(value); }
+    return d.getFullYear() + '-' + pad(d.getMonth() + 1) + '-' + pad(d.getDate()) + ' ' +
+      pad(d.getHours()) + ':' + pad(d.getMinutes()) + ':' + pad(d.getSeconds()) + '.' + pad(d.getMilliseconds(), 3);
+  }
+
+  // Value of datetime-local input in local time
+  function toLocalInput(d) {
+    return d.getFullYear() + '-' + pad(d.getMonth() + 1) + '-' + pad(d.getDate()) + 'T' +
+      pad(d.getHours()) + ':' + pad(d.getMinutes()) + ':' + pad(d.getSeconds());
+  }
+
+  function toISO(localValue) {
+    if (!localValue) { return ''; }
+    var d = new Date(localValue);
+    return isNaN(d.getTime()) ? '' : d.toISOString();
+  }
+
+  function setStatus(text, isError) {
+    $('status').textContent = text || '';
+    $('status').className = isError ? 'error' : '';
+  }
+
+  function headers() {
+    var h = { 'Content-Type': 'application/json' };
+    var token = localStorage.getItem('recause.token');
+    if (token) { h.Authorization = 'Bearer ' + token; }
+    return h;
+  }
+
+  // Calls JSON API and resolves with «data» of the response
+  function api(path, body) {
+    return fetch(path, { method: 'POST', headers: headers(), body: JSON.stringify(body) })
+      .then(function (rs) {
+        return rs.json().catch(function () { return { status: 'error', message: rs.status + ' ' + rs.statusText }; })
+          .then(function (payload) {
+            if (!rs.ok || payload.status !== 'ok') {
+              if (rs.status === 401) { $('settings').hidden = false; }
+              throw new Error(payload.message || (rs.status + ' ' + rs.statusText));
+            }
+            return payload.data;
+          });
+      });
+  }
+
+  function buildQuery() {
+    var q = { query: state.query };
+    if (state.tenant) { q.tenant = state.tenant; }
+    if (state.level) { q.min_level = state.level; }
+    if (state.range === 'custom') {
+      if (state.from) { q.from = toISO(state.from); }
+      if (state.to) { q.to = toISO(state.to); }
+    } else {
+      q.range = 'last ' + state.range;
+    }
+    return q;
+  }
+
+  // Permalink keeps everything except the token
+  function writeUrl(push) {
+    var params = new URLSearchParams();
+    if (state.query) { params.set('q', state.query); }
+    params.set('range', state.range);
+    if (state.range === 'custom') {
+      if (state.from) { params.set('from', toISO(state.from)); }
+      if (state.to) { params.set('to', toISO(state.to)); }
+    }
+    if (state.level) { params.set('level', state.level); }
+    if (state.tenant) { params.set('tenant', state.tenant); }
+    if (state.offset) { params.set('offset', state.offset); }
+    if (state.tail) { params.set('tail', '1'); }
+    var url = location.pathname + '?' + params.toString();
+    if (url === location.pathname + location.search) { return; }
+    if (push) { history.pushState(null, '', url); } else { history.replaceState(null, '', url); }
+  }
+
+  function readUrl() {
+    var params = new URLSearchParams(location.search);
+    state.query = params.get('q') || '';
+    state.range = params.get('range') || '1h';
+    state.from = params.get('from') ? toLocalInput(new Date(params.get('from'))) : '';
+    state.to = params.get('to') ? toLocalInput(new Date(params.get('to'))) : '';
+    state.level = params.get('level') || '';
+    state.tenant = params.get('tenant') || '';
+    state.offset = Math.max(0, parseInt(params.get('offset'), 10) || 0);
+    state.tail = params.get('tail') === '1';
+
+    if (!$('range').querySelector('option[value="' + state.range + '"]')) { state.range = '1h'; }
+    if (!$('level').querySelector('option[value="' + state.level + '"]')) { state.level = ''; }
+
+    $('query').value = state.query;
+    $('range').value = state.range;
+    $('from').value = state.from;
+    $('to').value = state.to;
+    $('level').value = state.level;
+    $('tenant').value = state.tenant;
+    $('tail').checked = state.tail;
+    $('custom').hidden = state.range !== 'custom';
+  }
+
+  function readForm() {
+    state.query = $('query').value.trim();
+    state.range = $('range').value;
+    state.from = $('from').value;
+    state.to = $('to').value;
+    state.level = $('level').value;
+    state.tenant = $('tenant').value.trim();
+    state.tail = $('tail').checked;
+  }
+
+  function renderMessage(msg) {
+    var li = el('li');
+    var summary = el('div', 'summary');
+    // Level 0 is not stored, its name tells it apart from messages without level
+    var level = typeof msg.level === 'number' ? msg.level : (msg.level_name === 'emerg' ? 0 : 6);
+
+    summary.appendChild(el('span', 'time', formatTime(msg.timestamp)));
+    summary.appendChild(el('span', 'level l' + level, msg.level_name || LEVELS[level] || level));
+    summary.appendChild(el('span', 'host', msg.host));
+    summary.appendChild(el('span', 'message', msg.short_message));
+    li.appendChild(summary);
+
+    summary.addEventListener('click', function () {
+      var details = li.querySelector('.details');
+      if (details) {
+        details.hidden = !details.hidden;
+        return;
+      }
+      li.appendChild(renderDetails(msg));
+    });
+
+    return li;
+  }
+
+  function renderDetails(msg) {
+    var details = el('div', 'details');
+    var table = el('table');
+
+    if (msg.full_message) { details.appendChild(el('pre', '', msg.full_message)); }
+
+    function row(name, value) {
+      if (value === undefined || value === null || value === '') { return; }
+      var tr = el('tr');
+      tr.appendChild(el('th', '', name));
+      tr.appendChild(el('td', '', typeof value === 'object' ? JSON.stringify(value, null, 2) : value));
+      table.appendChild(tr);
+    }
+
+    row('id', msg.id);
+    row('timestamp', msg.timestamp);
+    row('level', msg.level_name ? (msg.level || 0) + ' (' + msg.level_name + ')' : msg.level);
+    row('facility', msg.facility);
+    row('file', msg.file ? msg.file + (msg.line ? ':' + msg.line : '') : '');
+    row('tenant', msg.tenant);
+
+    Object.keys(msg.extra || {}).sort().forEach(function (key) {
+      row('extra.' + key.replace(/^_/, ''), msg.extra[key]);
+    });
+
+    details.appendChild(table);
+
+    return details;
+  }
+
+  function renderResults(result) {
+    var list = $('results');
+    list.textContent = '';
+    result.messages.forEach(function (msg) { list.appendChild(renderMessage(msg)); });
+
+    total = result.total;
+    var last = Math.min(state.offset + result.messages.length, total);
+    $('page').textContent = total ? (state.offset + 1) + '–' + last + ' of ' + total : '';
+    $('newer').disabled = state.offset === 0;
+    $('older').disabled = state.offset + PAGE_SIZE >= total;
+    setStatus(total + ' messages found in ' + result.took_ms + ' ms');
+  }
+
+  function renderHistogram(h) {
+    var strip = $('histogram');
+    var max = 0;
+    var interval = parseDuration(h.interval);
+    strip.textContent = '';
+
+    h.buckets.forEach(function (b) { max = Math.max(max, b.count); });
+    h.buckets.forEach(function (b) {
+      var bar = el('div', b.count ? 'bar' : 'bar empty');
+      var from = new Date(b.from);
+      var to = new Date(from.getTime() + interval);
+      if (b.count) { bar.style.height = Math.max(2, Math.round(b.count / max * 100)) + '%'; }
+      bar.title = formatTime(from) + ' — ' + b.count + ' messages';
+      bar.addEventListener('click', function () {
+        state.range = 'custom';
+        state.from = toLocalInput(from);
+        state.to = toLocalInput(to);
+        state.offset = 0;
+        $('range').value = 'custom';
+        $('from').value = state.from;
+        $('to').value = state.to;
+        $('custom').hidden = false;
+        run(true);
+      });
+      strip.appendChild(bar);
+    });
+  }
+
+  // Parses durations formatted by Go, e.g. «1m0s» or «168h0m0s»
+  function parseDuration(value) {
+    var units = { h: 3600000, m: 60000, s: 1000 };
+    var result = 0;
+    String(value).replace(/(\d+(?:\.\d+)?)([hms])/g, function (_, n, unit) { result += parseFloat(n) * units[unit]; });
+    return result;
+  }
+
+  function search() {
+    var seq = ++searchSeq;
+    var q = buildQuery();
+    setStatus('Searching…');
+
+    q.limit = PAGE_SIZE;
+    q.offset = state.offset;
+
+    api('/api/search/', q).then(function (result) {
+      if (seq === searchSeq) { renderResults(result); }
+    }).catch(function (err) {
+      if (seq === searchSeq) { setStatus(err.message, true); }
+    });
+
+    var hq = buildQuery();
+    hq.buckets = HISTOGRAM_BUCKETS;
+
+    api('/api/histogram/', hq).then(function (h) {
+      if (seq === searchSeq) { renderHistogram(h); }
+    }).catch(function () {
+      if (seq === searchSeq) { $('histogram').textContent = ''; }
+    });
+  }
+
+  // Follows new messages through the tail stream. fetch is used instead of EventSource,
+  // because EventSource can't send Authorization header
+  function startTail() {
+    stopTail();
+
+    var current = { controller: new AbortController(), lastId: '', timer: null };
+    tail = current;
+    document.body.classList.add('live');
+    $('results').textContent = '';
+    setStatus('Waiting for new messages…');
+
+    function connect() {
+      var params = new URLSearchParams();
+      var h = headers();
+      params.set('query', state.query);
+      if (state.tenant) { params.set('tenant', state.tenant); }
+      if (state.level) { params.set('min_level', state.level); }
+      if (current.lastId) { h['Last-Event-ID'] = current.lastId; }
+      delete h['Content-Type'];
+
+      fetch('/api/tail/?' + params.toString(), { headers: h, signal: current.controller.signal })
+        .then(function (rs) {
+          if (!rs.ok) {
+            return rs.json().catch(function () { return {}; }).then(function (payload) {
+              if (rs.status === 401) { $('settings').hidden = false; }
+              var err = new Error(payload.message || (rs.status + ' ' + rs.statusText));
+              err.fatal = rs.status < 500;
+              throw err;
+            });
+          }
+          return readStream(rs.body.getReader());
+        })
+        .then(function () { reconnect('Stream closed, reconnecting…'); })
+        .catch(function (err) {
+          if (err.name === 'AbortError' || tail !== current) { return; }
+          if (err.fatal) {
+            setStatus(err.message, true);
+            return;
+          }
+          reconnect(err.message + ', reconnecting…');
+        });
+    }
+
+    function reconnect(message) {
+      if (tail !== current) { return; }
+      setStatus(message, true);
+      current.timer = setTimeout(connect, TAIL_RETRY);
+    }
+
+    function readStream(reader) {
+      var decoder = new TextDecoder();
+      var buffer = '';
+
+      function pump() {
+        return reader.read().then(function (chunk) {
+          if (chunk.done) { return; }
+          buffer += decoder.decode(chunk.value, { stream: true }).replace(/\r\n?/g, '\n');
+
+          var end;
+          while ((end = buffer.indexOf('\n\n')) >= 0) {
+            handleEvent(buffer.slice(0, end));
+            buffer = buffer.slice(end + 2);
+          }
+
+          return pump();
+        });
+      }
+
+      return pump();
+    }
+
+    function handleEvent(text) {
+      var data = [];
+      var id = '';
+
+      text.split('\n').forEach(function (line) {
+        if (line.indexOf('data:') === 0) { data.push(line.slice(5).replace(/^ /, '')); }
+        if (line.indexOf('id:') === 0) { id = line.slice(3).trim(); }
+      });
+
+      if (!data.length) { return; }
+      if (id) { current.lastId = id; }
+
+      var msg;
+      try { msg = JSON.parse(data.join('\n')); } catch (e) { return; }
+
+      var list = $('results');
+      var li = renderMessage(msg);
+      li.className = 'new';
+      list.insertBefore(li, list.firstChild);
+      while (list.children.length > TAIL_LIMIT) { list.removeChild(list.lastChild); }
+      setStatus('Live: showing last ' + list.children.length + ' messages');
+    }
+
+    connect();
+  }
+
+  function stopTail() {
+    if (!tail) { return; }
+    clearTimeout(tail.timer);
+    tail.controller.abort();
+    tail = null;
+    document.body.classList.remove('live');
+  }
+
+  function run(push) {
+    writeUrl(push);
+    if (state.tail) {
+      startTail();
+    } else {
+      stopTail();
+      search();
+    }
+  }
+
+  $('search').addEventListener('submit', function (e) {
+    e.preventDefault();
+    readForm();
+    state.offset = 0;
+    run(true);
+  });
+
+  $('range').addEventListener('change', function () {
+    var custom = $('range').value === 'custom';
+    $('custom').hidden = !custom;
+    if (custom && !$('from').value) {
+      $('from').value = toLocalInput(new Date(Date.now() - 3600000));
+    }
+  });
+
+  $('level').addEventListener('change', function () {
+    readForm();
+    state.offset = 0;
+    run(true);
+  });
+
+  $('tail').addEventListener('change', function () {
+    readForm();
+    state.offset = 0;
+    run(true);
+  });
+
+  $('newer').addEventListener('click', function () {
+    state.offset = Math.max(0, state.offset - PAGE_SIZE);
+    run(true);
+  });
+
+  $('older').addEventListener('click', function () {
+    state.offset += PAGE_SIZE;
+    run(true);
+  });
+
+  $('help-toggle').addEventListener('click', function () { $('help').hidden = !$('help').hidden; });
+  $('settings-toggle').addEventListener('click', function () { $('settings').hidden = !$('settings').hidden; });
+
+  $('token').value = localStorage.getItem('recause.token') || '';
+  $('token').addEventListener('change', function () {
+    var token = $('token').value.trim();
+    if (token) { localStorage.setItem('recause.token', token); } else { localStorage.removeItem('recause.token'); }
+  });
+
+  window.addEventListener('popstate', function () {
+    readUrl();
+    run(false);
+  });
+
+  readUrl();
+  run(false);
+})();
+`
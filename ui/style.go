@@ -0,0 +1,68 @@
+package ui
+
+const appCss string = `* { box-sizing: border-box; }
+
+body {
+  margin: 0;
+  font: 14px/1.4 -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+  color: #222;
+  background: #fafafa;
+}
+
+header {
+  position: sticky;
+  top: 0;
+  z-index: 1;
+  padding: 8px 12px;
+  background: #263238;
+  color: #eceff1;
+}
+
+form { display: flex; flex-wrap: wrap; gap: 6px; align-items: center; }
+input, select, button { font: inherit; padding: 4px 6px; border: 1px solid #90a4ae; border-radius: 3px; }
+#query { flex: 1 1 320px; font-family: Menlo, Consolas, monospace; }
+button { cursor: pointer; background: #eceff1; }
+button:disabled { cursor: default; opacity: .5; }
+.toggle { display: flex; align-items: center; gap: 4px; cursor: pointer; }
+#tail { accent-color: #e53935; }
+
+.panel { margin-top: 8px; padding: 8px; background: #37474f; border-radius: 3px; }
+.panel label { margin-right: 16px; }
+.panel table { border-collapse: collapse; }
+.panel td { padding: 2px 12px 2px 0; vertical-align: top; }
+.panel code { color: #ffe082; }
+.panel p { margin: 6px 0 0; }
+
+#histogram { display: flex; align-items: flex-end; height: 64px; padding: 4px 12px 0; background: #fff; border-bottom: 1px solid #ddd; }
+#histogram .bar { flex: 1 1 0; min-width: 1px; margin-right: 1px; background: #64b5f6; cursor: zoom-in; }
+#histogram .bar:hover { background: #1e88e5; }
+#histogram .empty { background: #eceff1; height: 1px; }
+.live #histogram { opacity: .4; }
+
+#status { padding: 4px 12px; color: #607d8b; min-height: 1.4em; }
+#status.error { color: #c62828; }
+
+#results { list-style: none; margin: 0; padding: 0; font-family: Menlo, Consolas, monospace; font-size: 13px; }
+#results li { border-bottom: 1px solid #eee; background: #fff; }
+#results li.new { animation: highlight 2s; }
+@keyframes highlight { from { background: #fff9c4; } to { background: #fff; } }
+.summary { display: flex; gap: 10px; padding: 3px 12px; cursor: pointer; white-space: nowrap; }
+.summary:hover { background: #f5f5f5; }
+.time { color: #78909c; }
+.level { width: 5.5em; text-align: center; border-radius: 3px; font-size: 12px; }
+.host { color: #5e35b1; }
+.message { overflow: hidden; text-overflow: ellipsis; }
+.l0, .l1, .l2, .l3 { background: #ffcdd2; color: #b71c1c; }
+.l4 { background: #ffe0b2; color: #e65100; }
+.l5, .l6 { background: #e3f2fd; color: #0d47a1; }
+.l7 { background: #eceff1; color: #546e7a; }
+
+.details { padding: 4px 12px 8px 24px; background: #fcfcfc; }
+.details pre { margin: 0 0 6px; white-space: pre-wrap; word-break: break-all; }
+.details table { border-collapse: collapse; }
+.details th { text-align: left; padding-right: 16px; color: #607d8b; font-weight: normal; vertical-align: top; }
+.details td { white-space: pre-wrap; word-break: break-all; }
+
+#pager { display: flex; justify-content: center; gap: 12px; align-items: center; padding: 10px; }
+.live #pager { display: none; }
+`
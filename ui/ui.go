@@ -0,0 +1,70 @@
+// Package ui contains single-page interface for searching and tailing messages.
+// Assets are embedded into the binary, so the interface works without access to the internet
+package ui
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Path where interface is served
+const PREFIX string = "/ui/"
+
+type asset struct {
+	contentType string
+	body        string
+	etag        string
+}
+
+var assets map[string]*asset = map[string]*asset{
+	"":        newAsset("text/html; charset=utf-8", indexHtml),
+	"app.js":  newAsset("application/javascript; charset=utf-8", appJs),
+	"app.css": newAsset("text/css; charset=utf-8", appCss),
+}
+
+func newAsset(contentType, body string) *asset {
+	sum := sha1.Sum([]byte(body))
+
+	return &asset{
+		contentType: contentType,
+		body:        body,
+		etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+	}
+}
+
+// Serves assets of the interface. Assets don't require authentication,
+// API token is entered in the interface and sent with every API request
+func Serve(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	a, ok := assets[strings.TrimPrefix(req.URL.Path, PREFIX)]
+	if !ok {
+		http.NotFound(w, req)
+
+		return
+	}
+
+	// Browser revalidates assets, so new version is picked up right after upgrade
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", a.etag)
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data:")
+
+	if req.Header.Get("If-None-Match") == a.etag {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	if req.Method == "GET" {
+		_, _ = w.Write([]byte(a.body))
+	}
+}
@@ -0,0 +1,120 @@
+package workers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/endeveit/recause/logger"
+)
+
+// State of the component reported by readiness check
+type componentHealth struct {
+	Ready   bool        `json:"ready"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type receiverState struct {
+	Addr  string `json:"addr"`
+	Bound bool   `json:"bound"`
+}
+
+var (
+	mutexReceivers *sync.RWMutex             = &sync.RWMutex{}
+	receivers      map[string]*receiverState = make(map[string]*receiverState)
+)
+
+// Remembers if receiver listens for messages
+func setReceiverState(name, addr string, bound bool) {
+	mutexReceivers.Lock()
+	defer mutexReceivers.Unlock()
+
+	receivers[name] = &receiverState{
+		Addr:  addr,
+		Bound: bound,
+	}
+}
+
+// Reports that process is alive
+func (wh *WorkerHttp) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	statusOk(w, "alive")
+}
+
+// Reports if storage is reachable, buffer isn't overflowed and all receivers listen for messages
+func (wh *WorkerHttp) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	var (
+		components map[string]*componentHealth = make(map[string]*componentHealth)
+		ready      bool                        = true
+	)
+
+	storageHealth := wh.storage.Health()
+	components["storage"] = &componentHealth{
+		Ready:   storageHealth.Reachable,
+		Message: storageHealth.Error,
+		Details: storageHealth,
+	}
+
+	bufferHighWater := wh.getSettings().bufferHighWater
+
+	components["buffer"] = &componentHealth{
+		Ready: storageHealth.Buffered < bufferHighWater,
+		Details: map[string]int{
+			"buffered":   storageHealth.Buffered,
+			"high_water": bufferHighWater,
+		},
+	}
+
+	if !components["buffer"].Ready {
+		components["buffer"].Message = "Too many messages are waiting to be written to storage"
+	}
+
+	mutexReceivers.RLock()
+	for name, state := range receivers {
+		components["receiver_"+name] = &componentHealth{
+			Ready:   state.Bound,
+			Details: state,
+		}
+
+		if !state.Bound {
+			components["receiver_"+name].Message = fmt.Sprintf("Receiver doesn't listen on %s", state.Addr)
+		}
+	}
+	mutexReceivers.RUnlock()
+
+	for _, component := range components {
+		ready = ready && component.Ready
+	}
+
+	rs := &responseOk{
+		Status: "ok",
+		Data:   components,
+	}
+
+	code := http.StatusOK
+	if !ready {
+		rs.Status = "error"
+		code = http.StatusServiceUnavailable
+	}
+
+	addHeaders(w)
+
+	b, err := json.Marshal(rs)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to marshal response")
+
+		return
+	}
+
+	w.WriteHeader(code)
+
+	_, err = w.Write(b)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to write response")
+	}
+}
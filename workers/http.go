@@ -1,30 +1,60 @@
 package workers
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/braintree/manners"
 	"github.com/endeveit/go-snippets/cli"
-	"github.com/endeveit/go-snippets/config"
 	"github.com/gorilla/mux"
+	gc "github.com/robfig/config"
 
+	"github.com/endeveit/recause/auth"
+	"github.com/endeveit/recause/config"
 	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
 	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/saved"
 )
 
 type WorkerHttp struct {
-	addr       string
-	maxPerPage int
-	maxResults int
-	storage    storage.Storage
+	addr          string
+	storage       storage.Storage
+	savedSearches *saved.Store
+	tlsConfig     *tls.Config
+	cnField       string
+	tenant        string
+	settings      *httpSettings
+	mutexSettings *sync.RWMutex
+	// Closed on shutdown, so long-living streams don't block graceful stop
+	die chan bool
 }
 
+// Settings of HTTP server that may be changed without restart
+type httpSettings struct {
+	maxPerPage      int
+	maxResults      int
+	bufferHighWater int
+	// Nil means that API is available without authentication
+	tokens *auth.Tokens
+	// Messages may be sent through HTTP without tokens, otherwise ingestion requires tokens file
+	ingestWithoutAuth bool
+}
+
+type contextKey int
+
+const tokenContextKey contextKey = 0
+
 type responseError struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
@@ -40,28 +70,122 @@ func NewWorkerHttp(storage storage.Storage) *WorkerHttp {
 	addr, err := config.Instance().String("http", "addr")
 	cli.CheckError(err)
 
-	maxPerPage, err := config.Instance().Int("http", "max_per_page")
+	var savedSearches *saved.Store
+
+	savedPath, err := config.Instance().String("saved_searches", "datapath")
+	if err == nil && len(savedPath) > 0 {
+		savedSearches, err = saved.NewStore(savedPath)
+		cli.CheckError(err)
+	} else {
+		logger.Instance().
+			Info("Path to saved searches database is not provided, saved searches are disabled")
+	}
+
+	settings, err := readHttpSettings(config.Instance())
+	cli.CheckError(err)
+
+	if settings.tokens == nil {
+		logger.Instance().
+			Warning("Tokens file is not provided, API is available without authentication")
+	}
+
+	tlsConfig, err := newTlsConfig("http")
+	cli.CheckError(err)
+
+	config.RegisterReloadable(
+		"http.max_per_page",
+		"http.max_results",
+		"http.buffer_high_water",
+		"http.ingest_without_auth",
+		"auth.tokens_file")
+
+	return &WorkerHttp{
+		addr:          addr,
+		storage:       storage,
+		savedSearches: savedSearches,
+		tlsConfig:     tlsConfig,
+		cnField:       getCNField("http"),
+		tenant:        getListenerTenant("http"),
+		settings:      settings,
+		mutexSettings: &sync.RWMutex{},
+	}
+}
+
+// Reads limits and tokens from the config
+func readHttpSettings(c *gc.Config) (*httpSettings, error) {
+	maxPerPage, err := c.Int("http", "max_per_page")
 	if err != nil || maxPerPage <= 0 {
 		maxPerPage = 100
 	}
 
-	maxResults, err := config.Instance().Int("http", "max_results")
-	if err != nil || maxPerPage <= 0 {
+	maxResults, err := c.Int("http", "max_results")
+	if err != nil || maxResults <= 0 {
 		maxResults = 1000
 	}
 
-	return &WorkerHttp{
-		addr:       addr,
-		maxPerPage: maxPerPage,
-		maxResults: maxResults,
-		storage:    storage,
+	bufferHighWater, err := c.Int("http", "buffer_high_water")
+	if err != nil || bufferHighWater <= 0 {
+		bufferHighWater = 10000
 	}
+
+	var ingestWithoutAuth bool
+
+	switch value := config.Value(c, "http", "ingest_without_auth"); value {
+	case "", "off":
+	case "on":
+		ingestWithoutAuth = true
+	default:
+		return nil, fmt.Errorf("option «ingest_without_auth» must be on or off")
+	}
+
+	var tokens *auth.Tokens
+
+	tokensFile, err := c.String("auth", "tokens_file")
+	if err == nil && len(tokensFile) > 0 {
+		tokens, err = auth.LoadTokens(tokensFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &httpSettings{
+		maxPerPage:        maxPerPage,
+		maxResults:        maxResults,
+		bufferHighWater:   bufferHighWater,
+		tokens:            tokens,
+		ingestWithoutAuth: ingestWithoutAuth,
+	}, nil
+}
+
+// Reads new limits and re-reads tokens file, returned function applies them
+func (wh *WorkerHttp) PrepareReload(c *gc.Config) (func(), error) {
+	settings, err := readHttpSettings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		wh.mutexSettings.Lock()
+		defer wh.mutexSettings.Unlock()
+
+		wh.settings = settings
+	}, nil
+}
+
+// Returns current settings
+func (wh *WorkerHttp) getSettings() *httpSettings {
+	wh.mutexSettings.RLock()
+	defer wh.mutexSettings.RUnlock()
+
+	return wh.settings
 }
 
 // Runs HTTP server
 func (wh *WorkerHttp) Run(wg *sync.WaitGroup, die chan bool) {
 	defer wg.Done()
 
+	wh.die = die
+
 	server := manners.NewWithServer(&http.Server{
 		Addr:    wh.addr,
 		Handler: wh.getRouter(),
@@ -83,11 +207,38 @@ func (wh *WorkerHttp) Run(wg *sync.WaitGroup, die chan bool) {
 		}
 	}(server)
 
-	logger.Instance().
-		WithField("addr", server.Addr).
-		Info("HTTP server started")
+	if wh.tlsConfig != nil {
+		listener, err := net.Listen("tcp", wh.addr)
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("addr", wh.addr).
+				Error("Unable to start HTTPS server")
+
+			return
+		}
+
+		logger.Instance().
+			WithField("addr", server.Addr).
+			Info("HTTPS server started")
+
+		_ = server.Serve(tls.NewListener(listener, wh.tlsConfig))
+	} else {
+		logger.Instance().
+			WithField("addr", server.Addr).
+			Info("HTTP server started")
+
+		_ = server.ListenAndServe()
+	}
 
-	_ = server.ListenAndServe()
+	if wh.savedSearches != nil {
+		err := wh.savedSearches.Close()
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				Warning("Unable to close saved searches database")
+		}
+	}
 }
 
 // Returns mux router
@@ -95,12 +246,52 @@ func (wh *WorkerHttp) getRouter() (r *mux.Router) {
 	r = mux.NewRouter()
 	r.StrictSlash(true)
 
-	r.HandleFunc("/api/dump/{msgId}", wh.handleApiDump)
-	r.HandleFunc("/api/search/", wh.handleApiSearch)
+	wh.route(r, "/metrics", "", wh.handleMetrics)
+	wh.route(r, "/healthz", "", wh.handleHealthz)
+	wh.route(r, "/readyz", "", wh.handleReadyz)
+	wh.route(r, "/api/dump/{msgId}", auth.ROLE_READER, wh.handleApiDump)
+	wh.route(r, "/api/search/", auth.ROLE_READER, wh.handleApiSearch)
+	wh.route(r, "/api/histogram/", auth.ROLE_READER, wh.handleApiHistogram).Methods("POST")
+	wh.route(r, "/api/retention/", auth.ROLE_READER, wh.handleApiRetention).Methods("GET")
+	wh.route(r, "/api/ingest/", auth.ROLE_INGESTER, wh.handleApiIngest).Methods("POST")
+	wh.route(r, "/api/tail/", auth.ROLE_READER, wh.handleApiTail).Methods("GET")
+
+	if wh.savedSearches != nil {
+		wh.route(r, "/api/saved-searches/", auth.ROLE_READER, wh.handleApiSavedList).Methods("GET")
+		wh.route(r, "/api/saved-searches/", auth.ROLE_READER, wh.handleApiSavedCreate).Methods("POST")
+		wh.route(r, "/api/saved-searches/{searchId}", auth.ROLE_READER, wh.handleApiSavedGet).Methods("GET")
+		wh.route(r, "/api/saved-searches/{searchId}", auth.ROLE_READER, wh.handleApiSavedUpdate).Methods("PUT")
+		wh.route(r, "/api/saved-searches/{searchId}", auth.ROLE_READER, wh.handleApiSavedDelete).Methods("DELETE")
+		wh.route(r, "/api/saved-searches/{searchId}/execute", auth.ROLE_READER, wh.handleApiSavedExecute).
+			Methods("GET", "POST")
+	}
+
+	wh.routeUI(r)
 
 	return r
 }
 
+// Registers handler that requires role, empty role means that handler is available without authentication
+func (wh *WorkerHttp) route(r *mux.Router, path string, role auth.Role, handler http.HandlerFunc) *mux.Route {
+	if len(role) > 0 {
+		handler = wh.authorize(role, handler)
+	}
+
+	return r.HandleFunc(path, instrument(path, handler))
+}
+
+// Exports metrics in Prometheus text format
+func (wh *WorkerHttp) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	err := metrics.WriteText(w)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to write metrics")
+	}
+}
+
 // Dumps document
 func (wh *WorkerHttp) handleApiDump(w http.ResponseWriter, req *http.Request) {
 	msgId := mux.Vars(req)["msgId"]
@@ -111,7 +302,23 @@ func (wh *WorkerHttp) handleApiDump(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	doc, err := wh.storage.GetMessage(msgId)
+	// Only tenant is used, other fields are checked after the message is found
+	q := storage.SearchQuery{Tenant: req.URL.Query().Get("tenant")}
+
+	token := requestToken(req)
+	if token != nil {
+		token.Restrict(&q)
+	}
+
+	if len(q.Tenant) == 0 {
+		q.Tenant = storage.DefaultTenant()
+	} else if err := storage.ValidateTenantName(q.Tenant); err != nil {
+		statusError(w, "Provided tenant is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	doc, err := wh.storage.GetMessage(q.Tenant, msgId)
 	if err != nil {
 		logger.Instance().
 			WithError(err).
@@ -122,6 +329,18 @@ func (wh *WorkerHttp) handleApiDump(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if token != nil {
+		host, _ := doc["host"].(string)
+		facility, _ := doc["facility"].(string)
+
+		// Don't reveal existence of messages that token has no access to
+		if !token.AllowsMessage(host, facility) {
+			statusError(w, "Message not found", http.StatusNotFound)
+
+			return
+		}
+	}
+
 	statusOk(w, doc)
 }
 
@@ -155,31 +374,20 @@ func (wh *WorkerHttp) handleApiSearch(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	q.Query = strings.TrimSpace(q.Query)
-
-	if len(q.Query) > 0 {
-		err = wh.storage.ValidateQuery(q.Query)
-		if err != nil {
-			logger.Instance().
-				WithError(err).
-				WithField("query", q.Query).
-				Warning("Unable to validate JSON query")
-
-			statusError(w, "Provided query is invalid", http.StatusBadRequest)
-
-			return
-		}
+	if token := requestToken(req); token != nil {
+		token.Restrict(&q)
 	}
 
-	// Process limit and offset
-	if q.Limit <= 0 || q.Limit > wh.maxPerPage {
-		q.Limit = wh.maxPerPage
-	}
+	message, err := wh.prepareQuery(&q)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("query", q.Query).
+			Warning("Unable to validate JSON query")
 
-	if q.Offset < 0 {
-		q.Offset = 0
-	} else if q.Offset+q.Limit > wh.maxResults {
-		q.Offset = wh.maxResults - q.Limit
+		statusError(w, message, http.StatusBadRequest)
+
+		return
 	}
 
 	// Search for messages
@@ -198,6 +406,219 @@ func (wh *WorkerHttp) handleApiSearch(w http.ResponseWriter, req *http.Request)
 	statusOk(w, searchResponse)
 }
 
+// Counts messages matching the search query per time interval
+func (wh *WorkerHttp) handleApiHistogram(w http.ResponseWriter, req *http.Request) {
+	var rq struct {
+		storage.SearchQuery
+		// Desired number of buckets, actual number depends on the interval picked for the range
+		Buckets int `json:"buckets"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&rq)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to parse JSON")
+
+		statusError(w, "Provided JSON is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	if token := requestToken(req); token != nil {
+		token.Restrict(&rq.SearchQuery)
+	}
+
+	message, err := wh.prepareQuery(&rq.SearchQuery)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("query", rq.Query).
+			Warning("Unable to validate JSON query")
+
+		statusError(w, message, http.StatusBadRequest)
+
+		return
+	}
+
+	// Range is checked before the storage is asked, so client gets the reason
+	if _, err = storage.NewHistogram(&rq.SearchQuery, rq.Buckets, time.Now()); err != nil {
+		statusError(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	histogram, err := wh.storage.GetHistogram(&rq.SearchQuery, rq.Buckets)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("query", rq.Query).
+			Error("Unable to build histogram")
+
+		statusError(w, "An error occured while building histogram", http.StatusInternalServerError)
+
+		return
+	}
+
+	statusOk(w, histogram)
+}
+
+// Reports number of messages and the oldest message of every retention class
+func (wh *WorkerHttp) handleApiRetention(w http.ResponseWriter, req *http.Request) {
+	q := storage.SearchQuery{Tenant: req.URL.Query().Get("tenant")}
+
+	if token := requestToken(req); token != nil {
+		token.Restrict(&q)
+	}
+
+	if len(q.Tenant) == 0 {
+		q.Tenant = storage.DefaultTenant()
+	} else if err := storage.ValidateTenantName(q.Tenant); err != nil {
+		statusError(w, "Provided tenant is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	stats, err := wh.storage.GetRetentionStats(&q)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("tenant", q.Tenant).
+			Error("Unable to get retention stats")
+
+		statusError(w, "An error occured while getting retention stats", http.StatusInternalServerError)
+
+		return
+	}
+
+	statusOk(w, stats)
+}
+
+// Wraps handler with token authentication, requests are passed as is while authentication is disabled
+func (wh *WorkerHttp) authorize(role auth.Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		tokens := wh.getSettings().tokens
+		if tokens == nil {
+			handler(w, req)
+
+			return
+		}
+
+		token := tokens.Find(getRawToken(req))
+
+		if token == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="recause"`)
+			statusError(w, "Valid API token is required", http.StatusUnauthorized)
+
+			return
+		}
+
+		if !token.Allows(role) {
+			logger.Instance().
+				WithField("token", token.Name).
+				WithField("path", req.URL.Path).
+				Warning("Access denied")
+
+			statusError(w, "Access denied", http.StatusForbidden)
+
+			return
+		}
+
+		handler(w, req.WithContext(context.WithValue(req.Context(), tokenContextKey, token)))
+	}
+}
+
+// Returns token that was used to authenticate request, nil if authentication is disabled
+func requestToken(req *http.Request) *auth.Token {
+	token, _ := req.Context().Value(tokenContextKey).(*auth.Token)
+
+	return token
+}
+
+// Returns raw token from «Authorization: Bearer <token>» header
+func getRawToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	return ""
+}
+
+// Validates search query and applies limits to it, returns message suitable for client in case of error
+func (wh *WorkerHttp) prepareQuery(q *storage.SearchQuery) (string, error) {
+	q.Query = strings.TrimSpace(q.Query)
+
+	if len(q.Tenant) == 0 {
+		q.Tenant = storage.DefaultTenant()
+	} else if err := storage.ValidateTenantName(q.Tenant); err != nil {
+		return "Provided tenant is invalid", err
+	}
+
+	if len(q.Query) > 0 {
+		err := wh.storage.ValidateQuery(q.Tenant, q.Query)
+		if err != nil {
+			return "Provided query is invalid", err
+		}
+	}
+
+	err := q.ResolveRange(time.Now())
+	if err != nil {
+		return "Provided time range is invalid", err
+	}
+
+	if _, _, err = q.LevelThreshold(); err != nil {
+		return "Provided level is invalid", err
+	}
+
+	// Process limit and offset
+	settings := wh.getSettings()
+
+	if q.Limit <= 0 || q.Limit > settings.maxPerPage {
+		q.Limit = settings.maxPerPage
+	}
+
+	if q.Offset < 0 {
+		q.Offset = 0
+	} else if q.Offset+q.Limit > settings.maxResults {
+		q.Offset = settings.maxResults - q.Limit
+	}
+
+	return "", nil
+}
+
+// Response writer that remembers status code
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.code = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Passes flush to the underlying writer, so streaming responses work through the recorder
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Wraps handler to count requests and measure their duration
+func instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		handler(recorder, req)
+
+		metrics.HttpDuration.With(route).ObserveSince(started)
+		metrics.HttpRequests.With(route, strconv.Itoa(recorder.code)).Inc()
+	}
+}
+
 // Response with error
 func statusError(w http.ResponseWriter, message string, code int) {
 	rs := &responseError{
@@ -0,0 +1,155 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/endeveit/go-gelf/gelf"
+
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
+	"github.com/endeveit/recause/storage"
+)
+
+type ingestResult struct {
+	Accepted int `json:"accepted"`
+}
+
+const (
+	// Maximum size of a single GELF message received through HTTP
+	maxIngestLineSize int = 1024 * 1024
+	// Maximum size of the request body, it applies to compressed and decompressed body
+	maxIngestBodySize int64 = 16 * 1024 * 1024
+	// Maximum number of messages in one request, messages are held in memory until the whole body is read
+	maxIngestMessages int = 10000
+)
+
+// Receives GELF messages through HTTP, body contains one JSON-encoded message per line
+func (wh *WorkerHttp) handleApiIngest(w http.ResponseWriter, req *http.Request) {
+	if settings := wh.getSettings(); settings.tokens == nil && !settings.ingestWithoutAuth {
+		statusError(w, "Ingestion through HTTP requires API tokens", http.StatusForbidden)
+
+		return
+	}
+
+	var (
+		body     io.Reader = http.MaxBytesReader(w, req.Body, maxIngestBodySize)
+		messages []*storage.Message
+	)
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			statusError(w, "Request body is not gzipped", http.StatusBadRequest)
+
+			return
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+
+		body = gz
+	}
+
+	token := requestToken(req)
+	tenant := wh.tenant
+	clientCN := getClientCN(req.TLS)
+	sender, _, _ := net.SplitHostPort(req.RemoteAddr)
+
+	if token != nil && len(token.Tenant) > 0 {
+		tenant = token.Tenant
+	}
+
+	// Decompressed body is limited too, so small gzip bomb can't exhaust memory
+	limited := &io.LimitedReader{R: body, N: maxIngestBodySize + 1}
+
+	scanner := bufio.NewScanner(limited)
+	scanner.Buffer(make([]byte, 64*1024), maxIngestLineSize)
+
+	for scanner.Scan() {
+		// The last line may be cut by the limit
+		if limited.N <= 0 {
+			break
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		metrics.MessagesReceived.With("http").Inc()
+
+		if len(messages) >= maxIngestMessages {
+			metrics.MessagesDropped.With("http", "too_large").Add(float64(len(messages) + 1))
+
+			statusError(w, "Request contains too many messages", http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		message := new(gelf.Message)
+
+		err := json.Unmarshal(line, message)
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("body", string(line)).
+				Warning("Unable to parse GELF message")
+
+			metrics.MessagesDropped.With("http", "invalid").Add(float64(len(messages) + 1))
+
+			statusError(w, "Provided JSON is invalid", http.StatusBadRequest)
+
+			return
+		}
+
+		if token != nil && !token.AllowsMessage(message.Host, message.Facility) {
+			metrics.MessagesDropped.With("http", "forbidden").Add(float64(len(messages) + 1))
+
+			statusError(w, "Token is not allowed to send messages from this host or facility", http.StatusForbidden)
+
+			return
+		}
+
+		if len(clientCN) > 0 {
+			setExtraField(message, wh.cnField, clientCN)
+		}
+
+		msg := storage.NewMessageFromGelf(message)
+		msg.Tenant = tenant
+		msg.Sender = sender
+
+		messages = append(messages, msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to read request body")
+
+		statusError(w, "Unable to read request body", http.StatusBadRequest)
+
+		return
+	}
+
+	if limited.N <= 0 {
+		metrics.MessagesDropped.With("http", "too_large").Add(float64(len(messages)))
+
+		statusError(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+
+		return
+	}
+
+	metrics.MessagesParsed.With("http").Add(float64(len(messages)))
+
+	for _, message := range messages {
+		wh.storage.HandleMessage(message)
+	}
+
+	statusOk(w, &ingestResult{Accepted: len(messages)})
+}
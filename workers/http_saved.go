@@ -0,0 +1,281 @@
+package workers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/endeveit/recause/auth"
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/saved"
+)
+
+// Lists saved searches of the token tenant
+func (wh *WorkerHttp) handleApiSavedList(w http.ResponseWriter, req *http.Request) {
+	searches, err := wh.savedSearches.List(savedSearchTenant(req))
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Error("Unable to list saved searches")
+
+		statusError(w, "An error occured while getting saved searches", http.StatusInternalServerError)
+
+		return
+	}
+
+	statusOk(w, searches)
+}
+
+// Returns saved search
+func (wh *WorkerHttp) handleApiSavedGet(w http.ResponseWriter, req *http.Request) {
+	s, ok := wh.findSavedSearch(w, req)
+	if !ok {
+		return
+	}
+
+	statusOk(w, s)
+}
+
+// Creates new saved search
+func (wh *WorkerHttp) handleApiSavedCreate(w http.ResponseWriter, req *http.Request) {
+	s, ok := readSavedSearch(w, req)
+	if !ok {
+		return
+	}
+
+	s.Id = ""
+
+	if token := requestToken(req); token != nil && (!token.Allows(auth.ROLE_ADMIN) || len(s.Owner) == 0) {
+		s.Owner = token.Name
+	}
+
+	if tenant := savedSearchTenant(req); len(tenant) > 0 {
+		s.Tenant = tenant
+	}
+
+	wh.storeSavedSearch(w, s)
+}
+
+// Replaces existing saved search
+func (wh *WorkerHttp) handleApiSavedUpdate(w http.ResponseWriter, req *http.Request) {
+	existing, ok := wh.findSavedSearch(w, req)
+	if !ok || !canModifySavedSearch(w, req, existing) {
+		return
+	}
+
+	s, ok := readSavedSearch(w, req)
+	if !ok {
+		return
+	}
+
+	s.Id = existing.Id
+
+	if token := requestToken(req); token != nil && !token.Allows(auth.ROLE_ADMIN) {
+		s.Owner = existing.Owner
+	}
+
+	if tenant := savedSearchTenant(req); len(tenant) > 0 {
+		s.Tenant = tenant
+	}
+
+	wh.storeSavedSearch(w, s)
+}
+
+// Removes saved search
+func (wh *WorkerHttp) handleApiSavedDelete(w http.ResponseWriter, req *http.Request) {
+	existing, ok := wh.findSavedSearch(w, req)
+	if !ok || !canModifySavedSearch(w, req, existing) {
+		return
+	}
+
+	searchId := existing.Id
+
+	err := wh.savedSearches.Delete(searchId)
+	if err == saved.ErrNotFound {
+		statusError(w, "Saved search not found", http.StatusNotFound)
+
+		return
+	} else if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("id", searchId).
+			Error("Unable to delete saved search")
+
+		statusError(w, "An error occured while deleting saved search", http.StatusInternalServerError)
+
+		return
+	}
+
+	statusOk(w, searchId)
+}
+
+// Executes saved search, limit and offset may be overridden by the query string
+func (wh *WorkerHttp) handleApiSavedExecute(w http.ResponseWriter, req *http.Request) {
+	s, ok := wh.findSavedSearch(w, req)
+	if !ok {
+		return
+	}
+
+	q := s.Query
+	q.Tenant = s.Tenant
+
+	if token := requestToken(req); token != nil {
+		token.Restrict(&q)
+	}
+
+	if limit, err := strconv.Atoi(req.URL.Query().Get("limit")); err == nil {
+		q.Limit = limit
+	}
+
+	if offset, err := strconv.Atoi(req.URL.Query().Get("offset")); err == nil {
+		q.Offset = offset
+	}
+
+	message, err := wh.prepareQuery(&q)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("id", s.Id).
+			Warning("Saved search contains invalid query")
+
+		statusError(w, message, http.StatusBadRequest)
+
+		return
+	}
+
+	searchResponse, err := wh.storage.GetMessages(&q)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("id", s.Id).
+			Error("Unable to execute saved search")
+
+		statusError(w, "An error occured while searching messages", http.StatusInternalServerError)
+
+		return
+	}
+
+	statusOk(w, searchResponse)
+}
+
+// Returns saved search from the route or writes error response if it doesn't exist
+func (wh *WorkerHttp) findSavedSearch(w http.ResponseWriter, req *http.Request) (*saved.Search, bool) {
+	searchId := mux.Vars(req)["searchId"]
+
+	s, err := wh.savedSearches.Get(searchId, savedSearchTenant(req))
+	if err == saved.ErrNotFound {
+		statusError(w, "Saved search not found", http.StatusNotFound)
+
+		return nil, false
+	} else if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("id", searchId).
+			Error("Unable to get saved search")
+
+		statusError(w, "An error occured while getting saved search", http.StatusInternalServerError)
+
+		return nil, false
+	}
+
+	return s, true
+}
+
+// Returns tenant which saved searches are available to the token, empty string if all of them are available
+func savedSearchTenant(req *http.Request) string {
+	token := requestToken(req)
+
+	switch {
+	case token == nil:
+		return ""
+	case len(token.Tenant) > 0:
+		return token.Tenant
+	case token.Allows(auth.ROLE_ADMIN):
+		return ""
+	}
+
+	return storage.DefaultTenant()
+}
+
+// Checks if saved search may be changed by the token owner, only admins may change searches of other users
+func canModifySavedSearch(w http.ResponseWriter, req *http.Request, s *saved.Search) bool {
+	token := requestToken(req)
+
+	if token == nil || token.Allows(auth.ROLE_ADMIN) || token.Name == s.Owner {
+		return true
+	}
+
+	statusError(w, "Only owner of the saved search may change it", http.StatusForbidden)
+
+	return false
+}
+
+// Validates and stores saved search
+func (wh *WorkerHttp) storeSavedSearch(w http.ResponseWriter, s *saved.Search) {
+	err := s.Validate()
+	if err != nil {
+		statusError(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if len(s.Query.Query) > 0 {
+		err = wh.storage.ValidateQuery(s.Tenant, s.Query.Query)
+		if err != nil {
+			statusError(w, "Provided query is invalid", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	err = wh.savedSearches.Save(s)
+	if err == saved.ErrNotFound {
+		statusError(w, "Saved search not found", http.StatusNotFound)
+
+		return
+	} else if err != nil {
+		logger.Instance().
+			WithError(err).
+			Error("Unable to store saved search")
+
+		statusError(w, "An error occured while storing saved search", http.StatusInternalServerError)
+
+		return
+	}
+
+	statusOk(w, s)
+}
+
+// Parses saved search from request body
+func readSavedSearch(w http.ResponseWriter, req *http.Request) (*saved.Search, bool) {
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to read request body")
+
+		statusError(w, "Request body is empty", http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	s := new(saved.Search)
+
+	err = json.Unmarshal(requestBody, s)
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			WithField("body", string(requestBody)).
+			Warning("Unable to parse JSON")
+
+		statusError(w, "Provided JSON is invalid", http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	return s, true
+}
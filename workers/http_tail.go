@@ -0,0 +1,136 @@
+package workers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/endeveit/recause/auth"
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/storage"
+	"github.com/endeveit/recause/storage/match"
+)
+
+// Comments are sent periodically, so proxies don't close idle stream
+const tailHeartbeat time.Duration = 15 * time.Second
+
+// Streams new messages that match the query as server-sent events.
+// Client resumes the stream by passing id of the last received event in «Last-Event-ID» header
+func (wh *WorkerHttp) handleApiTail(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		statusError(w, "Streaming is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	params := req.URL.Query()
+	q := storage.SearchQuery{Query: params.Get("query"), Tenant: params.Get("tenant"), MinLevel: params.Get("min_level")}
+
+	token := requestToken(req)
+	if token != nil {
+		token.Restrict(&q)
+	}
+
+	if len(q.Tenant) == 0 {
+		q.Tenant = storage.DefaultTenant()
+	} else if err := storage.ValidateTenantName(q.Tenant); err != nil {
+		statusError(w, "Provided tenant is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	if _, _, err := q.LevelThreshold(); err != nil {
+		statusError(w, "Provided level is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	matcher, err := match.Compile(q.Query)
+	if err != nil {
+		statusError(w, "Provided query is invalid: "+err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	lastId := req.Header.Get("Last-Event-ID")
+	if len(lastId) == 0 {
+		lastId = params.Get("last_event_id")
+	}
+
+	live := storage.Live()
+	subscription, history := live.Subscribe(lastId)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(lm *storage.LiveMessage) error {
+		if !tailAllows(lm.Message, &q, token, matcher) {
+			return nil
+		}
+
+		b, err := json.Marshal(lm.Message)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", live.EventId(lm), b)
+
+		return err
+	}
+
+	_, err = fmt.Fprint(w, "retry: 3000\n\n")
+	for _, lm := range history {
+		if err != nil {
+			break
+		}
+
+		err = send(lm)
+	}
+
+	flusher.Flush()
+
+	ticker := time.NewTicker(tailHeartbeat)
+	defer ticker.Stop()
+
+	for err == nil {
+		select {
+		case lm := <-subscription.C:
+			err = send(lm)
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-req.Context().Done():
+			return
+		case <-wh.die:
+			return
+		}
+
+		flusher.Flush()
+	}
+
+	logger.Instance().
+		WithError(err).
+		WithField("dropped", subscription.Dropped()).
+		Debug("Tail stream is closed")
+}
+
+// Checks if message belongs to the tenant of the query, available to the token and matches the query
+func tailAllows(msg *storage.Message, q *storage.SearchQuery, token *auth.Token, matcher *match.Matcher) bool {
+	if msg.Tenant != q.Tenant {
+		return false
+	}
+
+	if token != nil && !token.AllowsMessage(msg.Host, msg.Facility) {
+		return false
+	}
+
+	if level, ok, _ := q.LevelThreshold(); ok && msg.Level > level {
+		return false
+	}
+
+	return matcher.Match(msg)
+}
@@ -0,0 +1,15 @@
+package workers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/endeveit/recause/ui"
+)
+
+// Registers routes of the web interface, root redirects to it
+func (wh *WorkerHttp) routeUI(r *mux.Router) {
+	r.Handle("/", http.RedirectHandler(ui.PREFIX, http.StatusFound))
+	r.PathPrefix(ui.PREFIX).HandlerFunc(instrument(ui.PREFIX, ui.Serve))
+}
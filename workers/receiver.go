@@ -7,15 +7,20 @@ import (
 
 	"github.com/endeveit/go-gelf/gelf"
 	"github.com/endeveit/go-snippets/cli"
-	"github.com/endeveit/go-snippets/config"
 
+	"github.com/endeveit/recause/config"
 	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
 	"github.com/endeveit/recause/storage"
 )
 
+// Number of received messages waiting for the storage
+const udpQueueSize int = 1024
+
 type WorkerReceiver struct {
 	storage storage.Storage
-	reader  *gelf.Reader
+	reader  *udpReader
+	tenant  string
 }
 
 // Returns packet receiver object
@@ -23,12 +28,13 @@ func NewWorkerReceiver(storage storage.Storage) *WorkerReceiver {
 	addr, err := config.Instance().String("receiver", "addr")
 	cli.CheckError(err)
 
-	reader, err := gelf.NewReader(addr)
+	reader, err := newUdpReader(addr)
 	cli.CheckError(err)
 
 	return &WorkerReceiver{
 		storage: storage,
 		reader:  reader,
+		tenant:  getListenerTenant("receiver"),
 	}
 }
 
@@ -37,14 +43,35 @@ func (wr *WorkerReceiver) Run(wg *sync.WaitGroup, die chan bool) {
 	var (
 		err     error
 		message *gelf.Message
+		sender  net.Addr
 	)
 
 	defer wg.Done()
 
+	// Messages are handled one by one in order they were received, so multiline reassembly gets lines in order
+	var (
+		queue     chan *storage.Message = make(chan *storage.Message, udpQueueSize)
+		delivered chan bool             = make(chan bool)
+	)
+
+	// Worker is done when queued messages are passed to the storage
+	defer func() {
+		close(queue)
+		<-delivered
+	}()
+
+	go func() {
+		wr.deliver(queue)
+		close(delivered)
+	}()
+
 	logger.Instance().
 		WithField("addr", wr.reader.Addr()).
 		Info("Packet receiver started")
 
+	setReceiverState("udp", wr.reader.Addr(), true)
+	defer setReceiverState("udp", wr.reader.Addr(), false)
+
 	for {
 		select {
 		case <-die:
@@ -53,14 +80,14 @@ func (wr *WorkerReceiver) Run(wg *sync.WaitGroup, die chan bool) {
 		}
 
 		// Set read timeout to prevent routine lock
-		err = wr.reader.GetConnection().SetDeadline(time.Now().Add(time.Second))
+		err = wr.reader.SetDeadline(time.Now().Add(time.Second))
 		if err != nil {
 			logger.Instance().
 				WithError(err).
 				Warning("Unable to set timeout")
 		}
 
-		message, err = wr.reader.ReadMessage()
+		message, sender, err = wr.reader.ReadMessage()
 
 		if err != nil {
 			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
@@ -71,11 +98,59 @@ func (wr *WorkerReceiver) Run(wg *sync.WaitGroup, die chan bool) {
 				logger.Instance().
 					WithError(err).
 					Warning("Unable to read message")
+
+				metrics.MessagesReceived.With("udp").Inc()
+				metrics.MessagesDropped.With("udp", "invalid").Inc()
 			}
 
 			continue
 		}
 
-		go wr.storage.HandleMessage(message)
+		metrics.MessagesReceived.With("udp").Inc()
+		metrics.MessagesParsed.With("udp").Inc()
+
+		msg := storage.NewMessageFromGelf(message)
+		msg.Tenant = wr.tenant
+		msg.Sender = senderIp(sender)
+
+		queue <- msg
+	}
+}
+
+// Passes received messages to the storage
+func (wr *WorkerReceiver) deliver(queue chan *storage.Message) {
+	for msg := range queue {
+		wr.storage.HandleMessage(msg)
+	}
+}
+
+// Returns tenant of messages received by the listener described in config section
+func getListenerTenant(section string) string {
+	tenant, err := config.Instance().String(section, "tenant")
+	if err != nil || len(tenant) == 0 {
+		return storage.DefaultTenant()
+	}
+
+	cli.CheckError(storage.ValidateTenantName(tenant))
+
+	return tenant
+}
+
+// Returns IP address of the sender without port
+func senderIp(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	case nil:
+		return ""
 	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
 }
@@ -0,0 +1,232 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/endeveit/go-gelf/gelf"
+	"github.com/endeveit/go-snippets/cli"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/logger"
+	"github.com/endeveit/recause/metrics"
+	"github.com/endeveit/recause/storage"
+)
+
+// Receives GELF messages delimited by null byte through TCP, optionally wrapped in TLS
+type WorkerTcpReceiver struct {
+	storage     storage.Storage
+	listener    *net.TCPListener
+	tlsConfig   *tls.Config
+	cnField     string
+	tenant      string
+	connections map[net.Conn]bool
+	mutex       *sync.Mutex
+}
+
+const (
+	// Maximum size of a single GELF message received through TCP
+	maxTcpFrameSize int = 1024 * 1024
+	// Connection is closed when client sends nothing during this period
+	tcpReadTimeout time.Duration = time.Minute
+)
+
+// Returns TCP receiver object or nil if it is not configured
+func NewWorkerTcpReceiver(storage storage.Storage) *WorkerTcpReceiver {
+	addr, err := config.Instance().String("receiver_tcp", "addr")
+	if err != nil || len(addr) == 0 {
+		return nil
+	}
+
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	cli.CheckError(err)
+
+	listener, err := net.ListenTCP("tcp", tcpAddr)
+	cli.CheckError(err)
+
+	tlsConfig, err := newTlsConfig("receiver_tcp")
+	cli.CheckError(err)
+
+	return &WorkerTcpReceiver{
+		storage:     storage,
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+		cnField:     getCNField("receiver_tcp"),
+		tenant:      getListenerTenant("receiver_tcp"),
+		connections: make(map[net.Conn]bool),
+		mutex:       &sync.Mutex{},
+	}
+}
+
+// Runs the TCP receiver
+func (wr *WorkerTcpReceiver) Run(wg *sync.WaitGroup, die chan bool) {
+	defer wg.Done()
+
+	logger.Instance().
+		WithField("addr", wr.listener.Addr().String()).
+		WithField("tls", wr.tlsConfig != nil).
+		Info("TCP receiver started")
+
+	setReceiverState("tcp", wr.listener.Addr().String(), true)
+	defer setReceiverState("tcp", wr.listener.Addr().String(), false)
+
+	for {
+		select {
+		case <-die:
+			wr.closeAll()
+			return
+		default:
+		}
+
+		// Set accept timeout to prevent routine lock
+		err := wr.listener.SetDeadline(time.Now().Add(time.Second))
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				Warning("Unable to set timeout")
+		}
+
+		conn, err := wr.listener.Accept()
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); !ok || !opErr.Timeout() {
+				logger.Instance().
+					WithError(err).
+					Warning("Unable to accept connection")
+			}
+
+			continue
+		}
+
+		if wr.tlsConfig != nil {
+			conn = tls.Server(conn, wr.tlsConfig)
+		}
+
+		wr.mutex.Lock()
+		wr.connections[conn] = true
+		wr.mutex.Unlock()
+
+		go wr.handleConnection(conn)
+	}
+}
+
+// Reads messages from connection until it is closed
+func (wr *WorkerTcpReceiver) handleConnection(conn net.Conn) {
+	var clientCN string
+
+	defer func() {
+		wr.mutex.Lock()
+		delete(wr.connections, conn)
+		wr.mutex.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		_ = conn.SetReadDeadline(time.Now().Add(tcpReadTimeout))
+
+		err := tlsConn.Handshake()
+		if err != nil {
+			logger.Instance().
+				WithError(err).
+				WithField("remote_addr", conn.RemoteAddr().String()).
+				Warning("TLS handshake failed")
+
+			return
+		}
+
+		state := tlsConn.ConnectionState()
+		clientCN = getClientCN(&state)
+	}
+
+	// Frame can't grow beyond the limit, so client that never sends null byte can't exhaust memory
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxTcpFrameSize)
+	scanner.Split(scanNullTerminated)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(tcpReadTimeout))
+
+		if !scanner.Scan() {
+			err := scanner.Err()
+
+			if err == bufio.ErrTooLong {
+				logger.Instance().
+					WithField("remote_addr", conn.RemoteAddr().String()).
+					Warning("Message is too large")
+
+				metrics.MessagesReceived.With("tcp").Inc()
+				metrics.MessagesDropped.With("tcp", "too_large").Inc()
+			} else if err != nil {
+				logger.Instance().
+					WithError(err).
+					WithField("remote_addr", conn.RemoteAddr().String()).
+					Debug("Unable to read message")
+			}
+
+			return
+		}
+
+		frame := bytes.TrimSpace(scanner.Bytes())
+
+		if len(frame) > 0 {
+			metrics.MessagesReceived.With("tcp").Inc()
+
+			message := new(gelf.Message)
+
+			if jsonErr := json.Unmarshal(frame, message); jsonErr != nil {
+				logger.Instance().
+					WithError(jsonErr).
+					Warning("Unable to parse GELF message")
+
+				metrics.MessagesDropped.With("tcp", "invalid").Inc()
+			} else {
+				metrics.MessagesParsed.With("tcp").Inc()
+
+				if len(clientCN) > 0 {
+					setExtraField(message, wr.cnField, clientCN)
+				}
+
+				msg := storage.NewMessageFromGelf(message)
+				msg.Tenant = wr.tenant
+				msg.Sender = senderIp(conn.RemoteAddr())
+
+				wr.storage.HandleMessage(msg)
+			}
+		}
+	}
+}
+
+// Splits stream into frames terminated by null byte, the last frame may be unterminated
+func scanNullTerminated(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// Closes all active connections
+func (wr *WorkerTcpReceiver) closeAll() {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+
+	for conn := range wr.connections {
+		_ = conn.Close()
+	}
+
+	err := wr.listener.Close()
+	if err != nil {
+		logger.Instance().
+			WithError(err).
+			Warning("Unable to close TCP listener")
+	}
+}
@@ -0,0 +1,229 @@
+package workers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/endeveit/go-gelf/gelf"
+)
+
+const (
+	// Maximum size of a single GELF message received through UDP, it applies to joined chunks and after decompression
+	maxUdpMessageSize int = 1024 * 1024
+	// Maximum number of chunks of a message allowed by GELF
+	maxUdpChunks int = 128
+	// Chunks of a message must arrive during this period
+	udpChunksTimeout time.Duration = 5 * time.Second
+	// Maximum number of messages which chunks are being collected
+	maxUdpPendingMessages int = 1024
+	// Maximum size of chunks of all incomplete messages, so spoofed chunks can't exhaust memory
+	maxUdpPendingSize int = 4 * 1024 * 1024
+)
+
+var (
+	gelfChunkMagic []byte = []byte{0x1e, 0x0f}
+	gzipMagic      []byte = []byte{0x1f, 0x8b}
+)
+
+// Reads GELF messages from UDP socket and reports their senders. Chunks of different senders are collected separately,
+// so interleaved chunked messages don't break each other
+type udpReader struct {
+	conn    *net.UDPConn
+	buf     []byte
+	pending map[string]*udpChunks
+	// Size of all pending chunks
+	pendingSize int
+}
+
+// Chunks of the message received so far
+type udpChunks struct {
+	parts    [][]byte
+	received int
+	size     int
+	started  time.Time
+}
+
+func newUdpReader(addr string) (*udpReader, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &udpReader{
+		conn:    conn,
+		buf:     make([]byte, 65536),
+		pending: make(map[string]*udpChunks),
+	}, nil
+}
+
+func (r *udpReader) Addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+func (r *udpReader) SetDeadline(t time.Time) error {
+	return r.conn.SetDeadline(t)
+}
+
+// Reads datagrams until the whole message is received, returns message and address of its sender
+func (r *udpReader) ReadMessage() (*gelf.Message, net.Addr, error) {
+	for {
+		n, addr, err := r.conn.ReadFrom(r.buf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r.expire(time.Now())
+
+		payload := r.buf[:n]
+
+		if bytes.HasPrefix(payload, gelfChunkMagic) {
+			if payload, err = r.addChunk(addr, payload); err != nil {
+				return nil, addr, err
+			}
+
+			// Message is not complete yet
+			if payload == nil {
+				continue
+			}
+		}
+
+		message, err := decodeGelf(payload)
+
+		return message, addr, err
+	}
+}
+
+// Stores chunk of the message, returns payload of the message when all its chunks are received
+func (r *udpReader) addChunk(addr net.Addr, chunk []byte) ([]byte, error) {
+	// Magic, 8 bytes of message id, sequence number and number of chunks
+	if len(chunk) < 12 {
+		return nil, errors.New("Chunk is too short")
+	}
+
+	var (
+		key   string = addr.String() + "/" + string(chunk[2:10])
+		seq   int    = int(chunk[10])
+		total int    = int(chunk[11])
+	)
+
+	if total == 0 || total > maxUdpChunks || seq >= total {
+		return nil, errors.New("Invalid chunk header")
+	}
+
+	chunks, ok := r.pending[key]
+	if !ok {
+		if len(r.pending) >= maxUdpPendingMessages {
+			return nil, errors.New("Too many incomplete chunked messages")
+		}
+
+		chunks = &udpChunks{parts: make([][]byte, total), started: time.Now()}
+		r.pending[key] = chunks
+	}
+
+	if len(chunks.parts) != total {
+		r.forget(key)
+
+		return nil, errors.New("Chunks of the message have different number of chunks")
+	}
+
+	if chunks.parts[seq] == nil {
+		data := chunk[12:]
+
+		if chunks.size+len(data) > maxUdpMessageSize {
+			r.forget(key)
+
+			return nil, errors.New("Message is too large")
+		}
+
+		if r.pendingSize+len(data) > maxUdpPendingSize {
+			if chunks.received == 0 {
+				r.forget(key)
+			}
+
+			return nil, errors.New("Too much data of incomplete chunked messages")
+		}
+
+		// Buffer is reused by the next read
+		chunks.parts[seq] = append([]byte{}, data...)
+		chunks.received++
+		chunks.size += len(data)
+		r.pendingSize += len(data)
+	}
+
+	if chunks.received < total {
+		return nil, nil
+	}
+
+	r.forget(key)
+
+	return bytes.Join(chunks.parts, nil), nil
+}
+
+// Removes chunks of the message
+func (r *udpReader) forget(key string) {
+	if chunks, ok := r.pending[key]; ok {
+		r.pendingSize -= chunks.size
+		delete(r.pending, key)
+	}
+}
+
+// Forgets messages which chunks didn't arrive in time
+func (r *udpReader) expire(now time.Time) {
+	for key, chunks := range r.pending {
+		if now.Sub(chunks.started) > udpChunksTimeout {
+			r.forget(key)
+		}
+	}
+}
+
+// Decompresses payload if needed and parses GELF message
+func decodeGelf(payload []byte) (*gelf.Message, error) {
+	var (
+		reader io.Reader
+		err    error
+	)
+
+	if len(payload) > maxUdpMessageSize {
+		return nil, errors.New("Message is too large")
+	}
+
+	switch {
+	case bytes.HasPrefix(payload, gzipMagic):
+		reader, err = gzip.NewReader(bytes.NewReader(payload))
+	case len(payload) > 0 && payload[0] == 0x78:
+		reader, err = zlib.NewReader(bytes.NewReader(payload))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reader != nil {
+		if payload, err = ioutil.ReadAll(io.LimitReader(reader, int64(maxUdpMessageSize)+1)); err != nil {
+			return nil, err
+		}
+
+		if len(payload) > maxUdpMessageSize {
+			return nil, errors.New("Message is too large")
+		}
+	}
+
+	message := new(gelf.Message)
+	if err = json.Unmarshal(payload, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,210 @@
+package workers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/endeveit/go-gelf/gelf"
+
+	"github.com/endeveit/recause/config"
+	"github.com/endeveit/recause/logger"
+)
+
+// Default name of the field where common name of the client certificate is stored
+const DEFAULT_CN_FIELD string = "tls_client_cn"
+
+// Minimum interval between checks of certificate files modification time
+const tlsCheckInterval time.Duration = 10 * time.Second
+
+// Structure that reloads certificates when their files are changed, so they may be rotated without restart
+type tlsLoader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+	mutex      *sync.Mutex
+	current    *tls.Config
+	modTimes   []time.Time
+	lastCheck  time.Time
+}
+
+// Returns TLS config described by «tls_*» options of the section, nil is returned when TLS is disabled
+func newTlsConfig(section string) (*tls.Config, error) {
+	certFile, err := config.Instance().String(section, "tls_cert")
+	if err != nil || len(certFile) == 0 {
+		return nil, nil
+	}
+
+	keyFile, err := config.Instance().String(section, "tls_key")
+	if err != nil || len(keyFile) == 0 {
+		return nil, fmt.Errorf("Option «tls_key» in section «%s» is required when «tls_cert» is set", section)
+	}
+
+	caFile, _ := config.Instance().String(section, "tls_client_ca")
+	clientAuthName, _ := config.Instance().String(section, "tls_client_auth")
+
+	loader := &tlsLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		mutex:    &sync.Mutex{},
+	}
+
+	switch clientAuthName {
+	case "", "none":
+		loader.clientAuth = tls.NoClientCert
+	case "request":
+		loader.clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		loader.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("Unknown value «%s» of «tls_client_auth» in section «%s»", clientAuthName, section)
+	}
+
+	if loader.clientAuth != tls.NoClientCert && len(caFile) == 0 {
+		return nil, fmt.Errorf("Option «tls_client_ca» in section «%s» is required to verify client certificates", section)
+	}
+
+	// Fail early if certificates are broken
+	loader.current, err = loader.load()
+	if err != nil {
+		return nil, err
+	}
+
+	loader.modTimes = loader.getModTimes()
+	loader.lastCheck = time.Now()
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: loader.getConfigForClient,
+	}, nil
+}
+
+// Returns actual config for every new connection
+func (l *tlsLoader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if time.Now().Sub(l.lastCheck) < tlsCheckInterval {
+		return l.current, nil
+	}
+
+	l.lastCheck = time.Now()
+	modTimes := l.getModTimes()
+
+	if !l.isChanged(modTimes) {
+		return l.current, nil
+	}
+
+	c, err := l.load()
+	if err != nil {
+		// Keep using previous certificates, new ones may be written partially
+		logger.Instance().
+			WithError(err).
+			WithField("cert", l.certFile).
+			Warning("Unable to reload TLS certificates")
+
+		return l.current, nil
+	}
+
+	logger.Instance().
+		WithField("cert", l.certFile).
+		Info("TLS certificates reloaded")
+
+	l.current = c
+	l.modTimes = modTimes
+
+	return l.current, nil
+}
+
+// Reads certificates from files
+func (l *tlsLoader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   l.clientAuth,
+	}
+
+	if len(l.caFile) > 0 {
+		pem, err := ioutil.ReadFile(l.caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		c.ClientCAs = x509.NewCertPool()
+		if !c.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in CA bundle " + l.caFile)
+		}
+	}
+
+	return c, nil
+}
+
+// Returns modification times of all files used by loader
+func (l *tlsLoader) getModTimes() []time.Time {
+	result := []time.Time{}
+
+	for _, filename := range []string{l.certFile, l.keyFile, l.caFile} {
+		var modTime time.Time
+
+		if len(filename) > 0 {
+			if fi, err := os.Stat(filename); err == nil {
+				modTime = fi.ModTime()
+			}
+		}
+
+		result = append(result, modTime)
+	}
+
+	return result
+}
+
+// Checks if any of files was modified
+func (l *tlsLoader) isChanged(modTimes []time.Time) bool {
+	for i, modTime := range modTimes {
+		if !modTime.Equal(l.modTimes[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns common name of the verified client certificate
+func getClientCN(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
+
+// Returns name of the field where client certificate common name should be stored
+func getCNField(section string) string {
+	field, err := config.Instance().String(section, "tls_cn_field")
+	if err != nil || len(field) == 0 {
+		return DEFAULT_CN_FIELD
+	}
+
+	return field
+}
+
+// Sets additional field of GELF message
+func setExtraField(message *gelf.Message, field string, value interface{}) {
+	if message.Extra == nil {
+		message.Extra = make(map[string]interface{})
+	}
+
+	message.Extra[field] = value
+}